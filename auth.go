@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+
+	tea "charm.land/bubbletea/v2"
+)
+
+// deniedMethodsPattern matches the authentication methods the server still
+// allowed when SSH gave up, e.g. 'Permission denied (publickey,password).'
+var deniedMethodsPattern = regexp.MustCompile(`Permission denied \(([^)]*)\)`)
+
+// interactiveMethods are the authentication methods that prompt for
+// something to be typed in, like a password or a one-time code.
+var interactiveMethods = []string{"password", "keyboard-interactive"}
+
+// needsInteractiveAuth reports whether SSH failing with 'stderr' was due to
+// the server wanting a password or a one-time code, which can't be typed in
+// while connecting in the background.
+func needsInteractiveAuth(stderr string) bool {
+	m := deniedMethodsPattern.FindStringSubmatch(stderr)
+	if m == nil {
+		return false
+	}
+	for _, method := range strings.Split(m[1], ",") {
+		if slices.Contains(interactiveMethods, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// needsHostKeyConfirmation reports whether SSH failing with 'stderr' was
+// due to the host key not being known yet, which can't be confirmed while
+// connecting in the background.
+func needsHostKeyConfirmation(stderr string) bool {
+	return classifyFailure(stderr, false).Summary == hostKeyUnknown
+}
+
+// backgroundOpts returns the options for connecting to 'i' in the
+// background, where nothing can be typed in. Passwords and codes aren't
+// asked for, and a host key that isn't known yet fails instead of asking
+// whether to trust it, unless the host's configuration says otherwise.
+func backgroundOpts(i Item) []string {
+	opts := []string{"-o", "PasswordAuthentication=no", "-o", "KbdInteractiveAuthentication=no"}
+	// Asking is the default, which SSH would do on the terminal
+	if v := strings.ToLower(optionValue(i.Options, "stricthostkeychecking")); v == "" || v == "ask" {
+		opts = append(opts, "-o", "StrictHostKeyChecking=yes")
+	}
+	return opts
+}
+
+// An authDoneMsg indicates that authenticating to 'item', which is at
+// 'index' of the unfiltered list, in the foreground has finished.
+type authDoneMsg struct {
+	item  Item
+	index int
+	err   error
+}
+
+// authCommand returns a command that hands the terminal over to SSH for
+// authenticating to 'i' with whatever it prompts for, including whether to
+// trust a host key it doesn't know yet. SSH then goes to the background as
+// the control master that connecting reuses.
+func authCommand(i Item, index int, sshOpts []string) tea.Cmd {
+	args := append(i.connectArgs(), sshOpts...)
+	args = append(args, sshControl.authOpts(i)...)
+	c := exec.Command(sshExecutableName, args...)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		return authDoneMsg{item: i, index: index, err: err}
+	})
+}
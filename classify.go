@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"charm.land/lipgloss/v2"
+)
+
+var (
+	failurePanelStyle = livePanelStyle.BorderForeground(nordAuroraRed)
+	failureTitleStyle = lipgloss.NewStyle().Foreground(nordAuroraRed)
+	failureHintStyle  = lipgloss.NewStyle().Foreground(nordAuroraYellow)
+)
+
+// A failureClass is a kind of failure to connect that SSH reports in a
+// recognizable way, along with what to do about it.
+type failureClass struct {
+	Summary string
+	Hint    string
+	// Patterns are matched against the standard error of SSH without
+	// regard to case
+	Patterns []string
+	// ViaJump is set for failures that are only recognizable as such when
+	// connecting through a jump host
+	ViaJump bool
+}
+
+// failureClasses are the failures that are recognized, in the order they're
+// matched in. Failures of a jump host also mention why the jump host could
+// not be reached and a changed host key also mentions that host key
+// verification failed, so those come first. A connection closed during the
+// handshake is what's left of many other failures, so that comes last.
+var failureClasses = []failureClass{
+	{
+		Summary:  hostKeyChanged,
+		Hint:     "The host presented a different key than the one in known_hosts. If the host was reinstalled, remove the old key with 'ssh-keygen -R <host>', otherwise find out why before connecting.",
+		Patterns: []string{"remote host identification has changed"},
+	},
+	{
+		Summary:  hostKeyUnknown,
+		Hint:     "The host's key is not in known_hosts yet. Connect with 'ssh <host>' to check its fingerprint and accept it.",
+		Patterns: []string{"host key is known for", "host key verification failed"},
+	},
+	{
+		Summary:  "ProxyJump failed",
+		Hint:     "The jump host could not be reached or could not reach the host. Check that the jump host can be connected to on its own and that it can reach the host's HostName and Port.",
+		Patterns: []string{"connection closed by unknown port 65535", "stdio forwarding failed", "channel 0: open failed", "kex_exchange_identification", "ssh_exchange_identification"},
+		ViaJump:  true,
+	},
+	{
+		Summary:  "DNS resolution failed",
+		Hint:     "The host's HostName does not resolve. Check it for typos and that it's known to DNS, e.g. with 'host <hostname>'.",
+		Patterns: []string{"could not resolve hostname", "name or service not known", "nodename nor servname provided", "temporary failure in name resolution"},
+	},
+	{
+		Summary:  "connection refused",
+		Hint:     "Nothing is listening on the SSH port. Check the host's Port and that the SSH server is running.",
+		Patterns: []string{"connection refused"},
+	},
+	{
+		Summary:  "connection timed out",
+		Hint:     "The host could not be reached. Check that it's up and that no firewall is in the way, e.g. by probing it with '-probe tcp'.",
+		Patterns: []string{"timed out", "no route to host", "network is unreachable", "host is down"},
+	},
+	{
+		Summary:  "too many authentication failures",
+		Hint:     "The server gave up before the right key was offered, usually because the agent holds many keys. Set 'IdentitiesOnly yes' along with the host's 'IdentityFile'.",
+		Patterns: []string{"too many authentication failures"},
+	},
+	{
+		Summary:  "permission denied (publickey)",
+		Hint:     "The server rejected every key that was offered. Check the host's User and IdentityFile and that the public key is in the server's authorized_keys.",
+		Patterns: []string{"permission denied (publickey"},
+	},
+	{
+		Summary:  "connection closed during handshake",
+		Hint:     "The server closed the connection before saying anything SSH understands. It may be refusing connections for now (e.g. fail2ban or MaxStartups) or something other than an SSH server may be listening on the port.",
+		Patterns: []string{"kex_exchange_identification", "ssh_exchange_identification", "connection closed by", "connection reset by"},
+	},
+}
+
+// hostKeyChanged is the summary of a changed host key, which can be
+// recovered from by removing the old key.
+const hostKeyChanged = "host key changed"
+
+// hostKeyUnknown is the summary of a host key that is not known yet.
+const hostKeyUnknown = "unknown host key"
+
+// unknownFailure is used for failures that are not recognized.
+var unknownFailure = failureClass{
+	Summary: "connection failed",
+	Hint:    "SSH did not say anything recognizable. Try connecting with 'ssh -v' to see more.",
+}
+
+// classifyFailure returns the class of failure described by 'stderr',
+// where 'viaJump' is whether the host was connected to through a jump host.
+func classifyFailure(stderr string, viaJump bool) failureClass {
+	lower := strings.ToLower(stderr)
+	for _, c := range failureClasses {
+		if c.ViaJump && !viaJump {
+			continue
+		}
+		for _, p := range c.Patterns {
+			if strings.Contains(lower, p) {
+				return c
+			}
+		}
+	}
+	return unknownFailure
+}
+
+// A connectFailure is a failed attempt at connecting to a host along with
+// everything SSH said about it. HostKey is set when the host key changed
+// and SSH said where the old one is.
+type connectFailure struct {
+	Item     Item
+	Class    failureClass
+	Stderr   string
+	ExitCode int
+	HostKey  *hostKeyMismatch
+}
+
+// newConnectFailure returns the failure of connecting to 'i', where SSH
+// wrote 'stderr' and exited with 'exitCode'.
+func newConnectFailure(i Item, stderr string, exitCode int) connectFailure {
+	stderr = strings.TrimSpace(strings.ReplaceAll(stderr, "\r\n", "\n"))
+	f := connectFailure{Item: i, Class: classifyFailure(stderr, i.ProxyJump != "" && i.ProxyJump != "none"), Stderr: stderr, ExitCode: exitCode}
+	if f.Class.Summary == hostKeyChanged {
+		if mismatch, err := parseHostKeyMismatch(stderr); err == nil {
+			f.HostKey = &mismatch
+		}
+	}
+	return f
+}
+
+// String returns the failure in the form shown in the status bar.
+func (f connectFailure) String() string {
+	return fmt.Sprintf("%q %s (exit code %d)", f.Item.Host, f.Class.Summary, f.ExitCode)
+}
+
+// view returns the panel shown after failing to connect, which wraps to
+// 'width'.
+func (f connectFailure) view(width int) string {
+	lines := []string{
+		failureTitleStyle.Render(fmt.Sprintf("Could not connect to %q: %s", f.Item.Host, f.Class.Summary)),
+		"",
+		failureHintStyle.Render(f.Class.Hint),
+		"",
+		fmt.Sprintf("SSH exited with code %d and said:", f.ExitCode),
+		"",
+		f.Stderr,
+		"",
+	}
+	if k := f.HostKey; k != nil {
+		old := k.OldFingerprint
+		if old == "" {
+			old = "unknown"
+		}
+		lines = append(lines,
+			fmt.Sprintf("Old key: %s in %s:%d", old, k.File, k.Line),
+			fmt.Sprintf("New key: %s (%s)", k.NewFingerprint, k.KeyType),
+			"",
+			failureHintStyle.Render(fmt.Sprintf("Replace every key of '%s' in %s with the new key and connect again? (y/N)", k.Host, k.File)),
+		)
+	} else {
+		lines = append(lines, versionStyle("esc back"))
+	}
+	style := failurePanelStyle
+	if width > 0 {
+		style = style.Width(width)
+	}
+	return style.Render(strings.Join(lines, "\n"))
+}
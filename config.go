@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A configValue is a setting from the configuration file, which is the
+// default of the flag called 'Key'.
+type configValue struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+// configPath returns the path of the configuration file, which is in the
+// user's configuration directory.
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "wishlistlite", "config"), nil
+}
+
+// loadConfig returns every setting in the configuration file at
+// 'filePath', where each line is a flag's name and its value separated by
+// an equals sign, e.g. 'launcher = kitty'. Blank lines and lines starting
+// with a '#' are skipped.
+func loadConfig(filePath string) ([]configValue, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var values []configValue
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected 'name = value'", filePath, n)
+		}
+		values = append(values, configValue{Key: strings.TrimSpace(key), Value: strings.TrimSpace(value), Line: n})
+	}
+	return values, scanner.Err()
+}
+
+// applyConfig sets the flags of 'fs' to the 'values' from the
+// configuration file at 'filePath', except for those given on the command
+// line, which take precedence. Repeatable flags may be given more than
+// once.
+func applyConfig(fs *flag.FlagSet, values []configValue, filePath string) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	for _, v := range values {
+		if fs.Lookup(v.Key) == nil {
+			return fmt.Errorf("%s:%d: unknown setting '%s'", filePath, v.Line, v.Key)
+		}
+		if given[v.Key] {
+			continue
+		}
+		if err := fs.Set(v.Key, v.Value); err != nil {
+			return fmt.Errorf("%s:%d: invalid value for '%s': %w", filePath, v.Line, v.Key, err)
+		}
+	}
+	return nil
+}
+
+// readConfig applies the configuration file at 'filePath' to the flags of
+// 'fs'. The file not existing is only an error when it was given
+// explicitly.
+func readConfig(fs *flag.FlagSet, filePath string, explicit bool) error {
+	values, err := loadConfig(filePath)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return applyConfig(fs, values, filePath)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+)
+
+// defaultConnectTimeout is how long connecting may take before it's given
+// up on as if it was canceled.
+const defaultConnectTimeout = 30 * time.Second
+
+// controlSocketPath returns the path of the control socket SSH uses when
+// connecting with 'args', as computed by 'ssh -G', or an empty string when
+// no control socket is used.
+func controlSocketPath(ctx context.Context, args []string) (string, error) {
+	out, err := exec.CommandContext(ctx, sshExecutableName, append([]string{"-G"}, args...)...).Output()
+	if err != nil {
+		return "", err
+	}
+	options := parseResolvedOptions(out)
+	paths := optionValues(options, "controlpath")
+	if len(paths) == 0 || paths[0] == "none" {
+		return "", nil
+	}
+	return expandControlPath(paths[0], options), nil
+}
+
+// expandControlPath returns 'path' with the tokens for the host, port, and
+// user replaced by their values among 'options', as older versions of SSH
+// print the control path as it was configured.
+func expandControlPath(path string, options []sshOption) string {
+	value := func(keyword string) string {
+		if values := optionValues(options, keyword); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	r := strings.NewReplacer("%%", "%", "%h", value("hostname"), "%p", value("port"), "%r", value("user"))
+	return expandTilde(r.Replace(path))
+}
+
+// removeStaleSocket removes the control socket at 'path' when nothing is
+// listening on it anymore, which is what is left behind when connecting is
+// cut short, and reports whether it did. A socket of a control master that
+// is still running is kept.
+func removeStaleSocket(path string) (bool, error) {
+	if _, err := os.Stat(path); err != nil {
+		return false, nil
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return false, nil
+	}
+	if err := os.Remove(path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// cleanupCommand returns a command that removes the control socket left
+// behind by connecting with 'args' in the background. It's done on a best
+// effort basis, so nothing is reported.
+func cleanupCommand(args []string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if path, err := controlSocketPath(ctx, args); err == nil && path != "" {
+			removeStaleSocket(path)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultControlPersist is how long a control master stays around after
+// its last connection, unless a host's configuration says otherwise.
+const defaultControlPersist = "5s"
+
+// controlOptions are where the control sockets of every SSH connection go
+// and how long their masters stay around.
+type controlOptions struct {
+	Dir     string
+	Persist string
+}
+
+// defaultControlDir returns the directory control sockets go in, which is
+// under '$XDG_RUNTIME_DIR' when that is set, as it's private to the user
+// and cleared on logout. Otherwise it's a directory of the user's own in
+// the temporary directory.
+func defaultControlDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "wishlistlite")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("wishlistlite-%d", os.Getuid()))
+}
+
+// path returns the control path given to SSH, with a socket for each host,
+// port, and user.
+func (c controlOptions) path() string {
+	return filepath.Join(c.Dir, controlSocketPrefix+"%h:%p:%r")
+}
+
+// persist returns how long the control master of 'i' stays around, which
+// is what its configuration sets as 'ControlPersist' if anything. Masters
+// that don't stay around at all couldn't be reused by the session, so such
+// a setting is ignored.
+func (c controlOptions) persist(i Item) string {
+	switch v := strings.ToLower(optionValue(i.Options, "controlpersist")); v {
+	case "", "no", "false":
+		return c.Persist
+	default:
+		return v
+	}
+}
+
+// childOpts returns the options for the session reusing a control master.
+func (c controlOptions) childOpts() []string {
+	return []string{"-S", c.path()}
+}
+
+// parentOpts returns the options for connecting to 'i' in the background,
+// which leaves a control master behind for the session.
+func (c controlOptions) parentOpts(i Item) []string {
+	return []string{"-T", "-o", "ControlMaster=auto", "-o", fmt.Sprintf("ControlPersist=%s", c.persist(i)), "-o", fmt.Sprintf("ControlPath=%s", c.path())}
+}
+
+// authOpts returns the options for authenticating to 'i' in the
+// foreground, after which SSH goes to the background as the control master.
+func (c controlOptions) authOpts(i Item) []string {
+	return []string{"-f", "-N", "-o", "ControlMaster=yes", "-o", fmt.Sprintf("ControlPersist=%s", c.persist(i)), "-o", fmt.Sprintf("ControlPath=%s", c.path())}
+}
+
+// prepareControlDir creates the directory at 'dir' for control sockets
+// when it doesn't exist yet and makes sure no one else can get at the
+// sockets in it: it must be a directory of the user's own that no one else
+// can write to, in a location where it can't be replaced by anyone else.
+func prepareControlDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("could not create control directory '%s': %w", dir, err)
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("control directory '%s' is not a directory", dir)
+	}
+	if err := checkControlDir(dir, info); err != nil {
+		return fmt.Errorf("refusing to use control directory '%s': %w", dir, err)
+	}
+	return nil
+}
+
+// errWorldWritable is returned for control directories that anyone could
+// put sockets in or remove them from.
+var errWorldWritable = errors.New("it's writable by others")
+
+// cleanStaleSockets removes every control socket in 'dir' that nothing is
+// listening on anymore, which is what runs that crashed leave behind, and
+// returns how many were removed.
+func cleanStaleSockets(dir string) int {
+	masters, err := listControlSockets(dir)
+	if err != nil {
+		return 0
+	}
+	var removed int
+	for _, c := range masters {
+		if ok, _ := removeStaleSocket(c.Path); ok {
+			removed++
+		}
+	}
+	return removed
+}
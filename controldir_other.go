@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// checkControlDir does nothing where there's no notion of owners and
+// permission bits, as the directory was already found to be a directory.
+func checkControlDir(dir string, info os.FileInfo) error {
+	return nil
+}
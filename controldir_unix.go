@@ -0,0 +1,38 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// checkControlDir makes sure the control directory at 'dir', described by
+// 'info', is owned by the user and that no one else can write to it or
+// replace it by writing to the directory it's in.
+func checkControlDir(dir string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errors.New("could not find out who owns it")
+	}
+	if uid := os.Getuid(); int(stat.Uid) != uid {
+		return fmt.Errorf("it's owned by user %d instead of %d", stat.Uid, uid)
+	}
+	if info.Mode().Perm()&0o022 != 0 {
+		return errWorldWritable
+	}
+
+	// Anyone could rename a directory in a directory they can write
+	// to, unless it's sticky like '/tmp'
+	parent, err := os.Stat(filepath.Dir(dir))
+	if err != nil {
+		return err
+	}
+	if parent.Mode().Perm()&0o002 != 0 && parent.Mode()&os.ModeSticky == 0 {
+		return fmt.Errorf("'%s' is writable by others without being sticky", filepath.Dir(dir))
+	}
+	return nil
+}
@@ -1,10 +1,9 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	"io"
-	"os/exec"
+	"net"
+	"slices"
 	"strings"
 	"time"
 
@@ -24,6 +23,7 @@ var (
 	nordAuroraYellow   = lipgloss.Color("#ebcb8b")
 	nordAuroraOrange   = lipgloss.Color("#d08770")
 	nordAuroraGreen    = lipgloss.Color("#a3be8c")
+	nordAuroraRed      = lipgloss.Color("#bf616a")
 	dimNordAuroraGreen = lipgloss.Color("#7a8e69")
 	titleStyle         = lipgloss.NewStyle().
 				Foreground(lipgloss.Color("#fffdf5ff"))
@@ -37,12 +37,39 @@ var (
 )
 
 // An Item is an item that appears in the list.
+//
+// Options holds every SSH configuration option that applies to the host,
+// of which 'User', 'Port', and 'ProxyJump' are also stored separately as
+// they're shown alongside the Hostname field.
+//
+// Hosts from an inventory instead carry the groups they belong to and the
+// variables that apply to them, which are used when connecting.
+//
+// Ping holds the result of the last time the host was pinged,
+// which stays shown alongside the Hostname field, and Status
+// holds whether it was reachable when last swept.
+//
+// Origins records every place the host was found in, the first of which
+// is where its fields came from. The names of the sources are shown
+// alongside the Hostname field when ShowSource is set.
 type Item struct {
 	Host         string
 	Hostname     string
 	Timestamp    string
-	Extra        string
+	User         string            `json:",omitempty"`
+	Port         string            `json:",omitempty"`
+	ProxyJump    string            `json:",omitempty"`
+	Groups       []string          `json:",omitempty"`
+	KeyType      string            `json:",omitempty"`
+	Origins      []itemOrigin      `json:",omitempty"`
+	Ping         *pingResult       `json:"-"`
+	Status       *hostStatus       `json:"-"`
+	Master       bool              `json:"-"`
+	Session      *sessionResult    `json:"-"`
+	Options      []sshOption       `json:"-"`
+	Vars         map[string]string `json:"-"`
 	SwitchFilter bool
+	ShowSource   bool `json:"-"`
 }
 
 // Title returns the Host field for an Item as that is the
@@ -51,15 +78,90 @@ func (i Item) Title() string { return i.Host }
 
 // Description returns the Timestamp field for an Item if
 // it is present (i.e. when in the Recently Used view),
-// otherwise just the Hostname field.
+// otherwise the Hostname field along with the User, Port,
+// and ProxyJump fields when those are present.
 func (i Item) Description() string {
 	if i.Timestamp != "" {
 		return i.Timestamp
 	}
-	if i.Extra != "" {
-		return fmt.Sprintf("%s :: %s", i.Hostname, i.Extra)
+	desc := i.Hostname
+	if i.Port != "" {
+		desc = net.JoinHostPort(desc, i.Port)
+	}
+	if i.User != "" {
+		desc = fmt.Sprintf("%s@%s", i.User, desc)
+	}
+	if i.ProxyJump != "" && i.ProxyJump != "none" {
+		desc = fmt.Sprintf("%s via %s", desc, i.ProxyJump)
+	}
+	if len(i.Groups) > 0 {
+		desc = fmt.Sprintf("%s [%s]", desc, strings.Join(i.Groups, ", "))
 	}
-	return i.Hostname
+	if i.KeyType != "" {
+		desc = fmt.Sprintf("%s :: %s", desc, i.KeyType)
+	}
+	if i.Ping != nil {
+		desc = fmt.Sprintf("%s | %s", desc, i.Ping.summary())
+	}
+	if i.Session != nil {
+		desc = fmt.Sprintf("%s | last session %s", desc, i.Session)
+	}
+	if i.ShowSource && len(i.Origins) > 0 {
+		desc = fmt.Sprintf("(%s) %s", i.sources(), desc)
+	}
+	// The markers are colored, so they're last to not affect
+	// the styling of the rest of the description
+	if i.Master {
+		desc = fmt.Sprintf("%s %s", desc, upStyle.Render("⚡"))
+	}
+	if i.Status != nil {
+		desc = fmt.Sprintf("%s %s", desc, i.Status.marker())
+	}
+	return desc
+}
+
+// connectArgs returns the arguments given to SSH for connecting
+// to an Item. Hosts from an SSH configuration only need their
+// name as SSH reads the same configuration, whereas hosts from
+// elsewhere bring along their user and port, as well as their
+// connection variables in the case of an inventory.
+func (i Item) connectArgs() []string {
+	if source := i.source(); source == "" || strings.HasPrefix(source, sshConfigSource) {
+		return []string{i.Host}
+	}
+	var args []string
+	if i.User != "" {
+		args = append(args, "-l", i.User)
+	}
+	if i.Port != "" {
+		args = append(args, "-p", i.Port)
+	}
+	if key := firstVar(i.Vars, "ansible_ssh_private_key_file", "ansible_private_key_file"); key != "" {
+		args = append(args, "-i", expandTilde(key))
+	}
+	args = append(args, strings.Fields(i.Vars["ansible_ssh_common_args"])...)
+	args = append(args, strings.Fields(i.Vars["ansible_ssh_extra_args"])...)
+	return append(args, i.Host)
+}
+
+// source returns the name of the source the fields of an Item
+// came from, or an empty string for items without an origin.
+func (i Item) source() string {
+	if len(i.Origins) == 0 {
+		return ""
+	}
+	return i.Origins[0].Source
+}
+
+// sources returns the names of every source an Item was found in.
+func (i Item) sources() string {
+	var names []string
+	for _, o := range i.Origins {
+		if !slices.Contains(names, o.Source) {
+			names = append(names, o.Source)
+		}
+	}
+	return strings.Join(names, ", ")
 }
 
 // FilterValue returns the value that is used when
@@ -77,26 +179,24 @@ type connection struct {
 	output      string
 	startupTime time.Duration
 	state       string
+	phases      []connectPhase
 }
 
-// A connectionOutputMsg indicates that something has
-// been written to the standard output of a connection.
-type connectionOutputMsg []string
-
-// A connectionErrorMsg indicates that something has
-// been written to the standard error of a connection.
-type connectionErrorMsg []string
+// A hostsLoadedMsg carries the hosts from every source after
+// they were loaded again along with any errors from doing so.
+type hostsLoadedMsg struct {
+	items []list.Item
+	errs  []error
+}
 
 type model struct {
 	list             list.Model
 	originalItems    []list.Item
 	sortedItems      []list.Item
 	choice           string
+	choiceArgs       []string
 	quitting         bool
 	connection       connection
-	err              string
-	errorChan        chan []string
-	outputChan       chan []string
 	connectInput     textinput.Model
 	sorted           bool
 	defaultDelegate  list.ItemDelegate
@@ -107,6 +207,28 @@ type model struct {
 	recentlyUsedPath string
 	pingOpts         []string
 	sshOpts          []string
+	probe            string
+	probeTimeout     time.Duration
+	jobs             *jobManager
+	showJobs         bool
+	jobCursor        int
+	sweeper          *sweeper
+	sweepOnStart     bool
+	statusCache      statusCache
+	statusTTL        time.Duration
+	live             *livePing
+	liveInterval     time.Duration
+	connectTimeout   time.Duration
+	interactiveHosts string
+	authAttempted    string
+	failure          *connectFailure
+	controlDir       string
+	masters          []controlMaster
+	showMasters      bool
+	masterCursor     int
+	loop             bool
+	launcher         Launcher
+	launchWith       Launcher
 }
 
 func newModel(items, sortedItems []list.Item, path string, pingOpts, sshOpts []string) model {
@@ -142,7 +264,13 @@ func newModel(items, sortedItems []list.Item, path string, pingOpts, sshOpts []s
 		customKeys.Sort,
 		customKeys.Delete,
 		customKeys.Ping,
+		customKeys.Live,
 		customKeys.Copy,
+		customKeys.Sweep,
+		customKeys.Jobs,
+		customKeys.Masters,
+		customKeys.TmuxWindow,
+		customKeys.TmuxSplit,
 	}
 	// Make sure custom keys have help text available
 	hostList.AdditionalShortHelpKeys = func() []key.Binding { return bindings }
@@ -166,8 +294,6 @@ func newModel(items, sortedItems []list.Item, path string, pingOpts, sshOpts []s
 	st := stopwatch.New(stopwatch.WithInterval(time.Millisecond))
 	return model{
 		list:             hostList,
-		errorChan:        make(chan []string),
-		outputChan:       make(chan []string),
 		connectInput:     input,
 		originalItems:    items,
 		sortedItems:      sortedItems,
@@ -179,78 +305,29 @@ func newModel(items, sortedItems []list.Item, path string, pingOpts, sshOpts []s
 		recentlyUsedPath: path,
 		pingOpts:         pingOpts,
 		sshOpts:          sshOpts,
-	}
-}
-
-// execCommand returns a command that runs 'name' command with
-// 'arg...' in the background when called writing to channels
-// 'outChan' and 'errChan' depending on the scenario.
-//
-// 'lineTail' is for the purposes of storing only the last N
-// number of lines from an output.
-//
-// 'wait' is required for commands where the entire output is
-// required and the command must waited upon to finish.
-func execCommand(outChan chan []string, errChan chan []string, name string, lineTail int, wait bool, arg ...string) tea.Cmd {
-	return func() tea.Msg {
-		c := exec.Command(name, arg...)
-		stdout, _ := c.StdoutPipe()
-		stderr, _ := c.StderrPipe()
-
-		c.Start()
-
-		slurp, _ := io.ReadAll(stderr)
-		if len(slurp) > 0 {
-			slurp := strings.Split(string(slurp), "")
-			errChan <- connectionErrorMsg(slurp)
-			return tea.Quit
-		}
-
-		scanner := bufio.NewScanner(stdout)
-		scanner.Split(bufio.ScanLines)
-
-		var out []string
-		out = append(out, scanner.Text())
-		for scanner.Scan() {
-			out = append(out, scanner.Text())
-		}
-		if lineTail > 0 {
-			out = out[len(out)-lineTail:]
-		}
-		outChan <- connectionOutputMsg(out)
-		if wait {
-			c.Wait()
-		}
-		return nil
-	}
-}
-
-// waitForCommandError returns a tea.Cmd that waits for
-// standard error activity on a channel.
-func waitForCommandError(c chan []string) tea.Cmd {
-	return func() tea.Msg {
-		return connectionErrorMsg(<-c)
-	}
-}
-
-// waitForCommandOutput returns a tea.Cmd that waits for
-// standard output activity on a channel.
-func waitForCommandOutput(c chan []string) tea.Cmd {
-	return func() tea.Msg {
-		return connectionOutputMsg(<-c)
+		probe:            icmpProbe,
+		probeTimeout:     defaultProbeTimeout,
+		sweeper:          &sweeper{workers: defaultSweepWorkers, rate: defaultSweepRate, timeout: defaultProbeTimeout, probe: icmpProbe, sshOpts: sshOpts},
+		jobs:             &jobManager{},
+		statusCache:      make(statusCache),
+		statusTTL:        defaultSweepTTL,
+		liveInterval:     defaultLiveInterval,
+		connectTimeout:   defaultConnectTimeout,
+		controlDir:       sshControl.Dir,
 	}
 }
 
 // Init initializes the model by returning commands through
-// tea.Batch. In this case it sets up the model in a way
-// that there are two commands - one for standard error and
-// one for standard output - that will immediately be
-// waited upon.
+// tea.Batch. In this case it looks for hosts with a control
+// master and starts sweeping every host when that was asked
+// for, as everything else is started through keypresses.
 func (m model) Init() tea.Cmd {
-	return tea.Batch(
-		waitForCommandError(m.errorChan),
-		waitForCommandOutput(m.outputChan),
-	)
+	cmds := []tea.Cmd{listMastersCommand(m.controlDir)}
+	if m.sweepOnStart {
+		customKeys.Sweep.SetHelp("s", "stop sweep")
+		cmds = append(cmds, m.sweeper.start(m.originalItems))
+	}
+	return tea.Batch(cmds...)
 }
 
 // Update returns the updated model and an optional command.
@@ -264,6 +341,22 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		h, v := docStyle.GetFrameSize()
 		m.list.SetSize(msg.Width-h, msg.Height-v)
+	// When the sources were loaded again replace the default
+	// view's items, but leave the status bar alone while busy
+	case hostsLoadedMsg:
+		msg.items = markMasters(m.statusCache.apply(msg.items, m.statusTTL), m.masters)
+		m.originalItems = msg.items
+		if !m.sorted {
+			cmds = append(cmds, m.list.SetItems(msg.items))
+		}
+		if m.connection.state != "Connecting" && m.connection.state != "Authenticating" && m.connection.state != "Running" && m.connection.state != "LivePinging" {
+			m.connection.state = "Reloaded"
+			m.connection.output = fmt.Sprintf("Reloaded %d hosts", len(msg.items))
+			if len(msg.errs) > 0 {
+				m.connection.state = "Warning"
+				m.connection.output = sourceWarning(msg.errs)
+			}
+		}
 	}
 
 	// When the custom connection input is focused
@@ -272,6 +365,50 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.updateCustomInput(msg)
 	}
 
+	// While in live ping mode only the keys for leaving it are
+	// of interest, whereas everything else keeps the list and
+	// sweeps up to date behind its panel
+	if _, ok := msg.(tea.KeyPressMsg); ok && m.connection.state == "LivePinging" {
+		return m.updateLivePing(msg)
+	}
+
+	// The same goes for the list of jobs
+	if _, ok := msg.(tea.KeyPressMsg); ok && m.showJobs {
+		return m.updateJobs(msg)
+	}
+
+	// And for the list of control masters
+	if _, ok := msg.(tea.KeyPressMsg); ok && m.showMasters {
+		return m.updateMasters(msg)
+	}
+
+	// And while connecting only the keys for canceling it
+	// or for showing the list of jobs are
+	if _, ok := msg.(tea.KeyPressMsg); ok && m.connection.state == "Connecting" {
+		return m.updateConnecting(msg)
+	}
+
+	// Failing to connect shows what went wrong until that is
+	// dismissed, after which it stays in the status bar. When
+	// the host key changed the old key can be replaced by the
+	// new one first for connecting again
+	if msg, ok := msg.(tea.KeyPressMsg); ok && m.connection.state == "Failed" {
+		switch msg.String() {
+		case "ctrl+c":
+			return m.quitProgram()
+		case "y":
+			if m.failure.HostKey == nil {
+				break
+			}
+			m.connection.state = "Replacing"
+			return m, replaceHostKeyCommand(m.failure.Item, *m.failure.HostKey, m.sshOpts)
+		case "esc", "q", "enter", "n":
+			m.connection.state = "Pinged"
+			m.failure = nil
+		}
+		return m, nil
+	}
+
 	if m.sorted {
 		switch msg := msg.(type) {
 		case tea.KeyPressMsg:
@@ -321,26 +458,43 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		case key.Matches(msg, customKeys.Ping):
 			i, ok := m.list.SelectedItem().(Item)
-			if ok {
-				m.connection.state = "Pinging"
-				m.choice = i.Hostname
+			if ok && m.probe == tcpProbe {
+				m.connection.state = "Running"
+				jb, ctx := m.jobs.start(probeJob, i, m.list.GlobalIndex(), fmt.Sprintf("Probing %q", i.probeAddress()))
+				cmds = append(cmds, m.pingSpinner.Tick)
+				cmds = append(cmds, probeCommand(ctx, jb.ID, i, m.sshOpts, m.probeTimeout))
+			} else if ok {
+				m.connection.state = "Running"
+				jb, ctx := m.jobs.start(pingJob, i, m.list.GlobalIndex(), fmt.Sprintf("Pinging %q %s times", i.Host, m.pingOpts[len(m.pingOpts)-1]))
 				cmds = append(cmds, m.pingSpinner.Tick)
-				cmds = append(cmds, execCommand(m.outputChan, m.errorChan, "ping", 2, true, append([]string{m.choice}, m.pingOpts...)...))
+				cmds = append(cmds, pingCommand(ctx, jb.ID, i.connectHost(), m.pingOpts))
 			}
 
-		case key.Matches(msg, customKeys.Connect):
+		case key.Matches(msg, customKeys.Live):
 			i, ok := m.list.SelectedItem().(Item)
 			if ok {
-				m.connection.state = "Connecting"
-				m.choice = i.Host
-				cmds = append(cmds, m.spinner.Tick)
-				cmds = append(cmds, m.stopwatch.Init())
-				// Extremely hack-y way to prepend 'm.choice'
-				opts := append([]string{m.choice}, m.sshOpts...)
-				opts = append(opts, sshControlParentOpts...)
-				cmds = append(cmds, execCommand(m.outputChan, m.errorChan, sshExecutableName, 0, false, opts...))
+				m.connection.state = "LivePinging"
+				m.live = &livePing{item: i, interval: m.liveInterval, timeout: m.probeTimeout, probe: m.probe, sshOpts: m.sshOpts}
+				cmds = append(cmds, m.live.start())
 			}
 
+		// Sessions open through the launcher instead when there
+		// is one that works from here
+		case key.Matches(msg, customKeys.Connect):
+			m.launchWith = nil
+			if m.launcher != nil && m.launcher.Available() {
+				m.launchWith = m.launcher
+			}
+			cmds = append(cmds, m.connectSelected())
+
+		case key.Matches(msg, customKeys.TmuxWindow):
+			m.launchWith = launchers["tmux"]
+			cmds = append(cmds, m.connectSelected())
+
+		case key.Matches(msg, customKeys.TmuxSplit):
+			m.launchWith = launchers["tmux-split"]
+			cmds = append(cmds, m.connectSelected())
+
 		case key.Matches(msg, customKeys.Sort):
 			m.connection.state = "Sorting"
 			if len(m.sortedItems) == 0 {
@@ -349,6 +503,28 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m.sort(msg)
 			}
 
+		case key.Matches(msg, customKeys.Sweep):
+			if m.sweeper.running() {
+				m.sweeper.stop()
+				customKeys.Sweep.SetHelp("s", "sweep hosts")
+				break
+			}
+			customKeys.Sweep.SetHelp("s", "stop sweep")
+			m.originalItems = markUnknown(m.originalItems)
+			if !m.sorted {
+				cmds = append(cmds, m.list.SetItems(m.originalItems))
+			}
+			cmds = append(cmds, m.sweeper.start(m.originalItems))
+
+		case key.Matches(msg, customKeys.Jobs):
+			m.showJobs = true
+			m.jobCursor = 0
+
+		case key.Matches(msg, customKeys.Masters):
+			m.showMasters = true
+			m.masterCursor = 0
+			cmds = append(cmds, listMastersCommand(m.controlDir))
+
 		case key.Matches(msg, customKeys.Copy):
 			i, ok := m.list.SelectedItem().(Item)
 			if ok {
@@ -362,43 +538,189 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
-	case connectionErrorMsg:
-		if m.connection.state == "Pinging" {
+	// Results of jobs that were canceled are dropped
+	case pingJobMsg:
+		jb, ok := m.jobs.finish(msg.id)
+		if !ok {
+			break
+		}
+		i := jb.Item
+		var output string
+		if msg.stderr != "" {
+			output = fmt.Sprintf("%q %s", i.Host, strings.Split(msg.stderr, "\n")[0])
+		} else if result, err := parsePingOutput(msg.output); err != nil {
+			output = fmt.Sprintf("%q could not ping", i.Host)
+		} else {
+			output = fmt.Sprintf("%q %s", i.Host, result)
+			// The list may have been reloaded while pinging
+			items := m.list.Items()
+			if jb.Index < len(items) && items[jb.Index].(Item).Hostname == i.Hostname {
+				i = items[jb.Index].(Item)
+				i.Ping = &result
+				cmds = append(cmds, m.setItem(jb.Index, i))
+			}
+		}
+		m.showJobResult(output)
+	// Phases are shown as they're done, but any still coming
+	// after connecting was canceled are only drained
+	case connectPhaseMsg:
+		if jb, ok := m.jobs.byKind(connectJob); ok && jb.ID == msg.id && m.connection.state == "Connecting" {
+			m.connection.phases = append(m.connection.phases, msg.phase)
+		}
+		cmds = append(cmds, waitForConnectPhase(msg.phases))
+	// Once authenticated the control master is there to be
+	// reused by connecting as usual
+	case authDoneMsg:
+		if m.connection.state != "Authenticating" {
+			break
+		}
+		if msg.err != nil {
+			m.choice = ""
 			m.connection.state = "Pinged"
-			m.connection.output = fmt.Sprintf("%q %s", m.list.SelectedItem().(Item).Host, strings.Split(strings.Join(msg, ""), "\n")[0])
-			cmds = append(cmds, waitForCommandError(m.errorChan)) // Continue waiting for new errors
-		} else if m.connection.state == "Connecting" {
+			m.connection.output = fmt.Sprintf("%q could not authenticate: %v", msg.item.Host, msg.err)
+			break
+		}
+		cmds = append(cmds, m.connect(msg.item, msg.index))
+	case hostKeyReplacedMsg:
+		if m.connection.state != "Replacing" {
+			break
+		}
+		m.failure = nil
+		if msg.err != nil {
 			m.connection.state = "Pinged"
-			m.connection.output = fmt.Sprintf("%q %s", m.list.SelectedItem().(Item).Host, strings.Split(strings.Join(msg, ""), "\r\n")[0])
+			m.connection.output = fmt.Sprintf("%q could not replace old host key: %v", msg.item.Host, msg.err)
+			break
+		}
+		// The host is where it was unless the list changed since
+		index := slices.IndexFunc(m.list.Items(), func(li list.Item) bool { return li.(Item).Host == msg.item.Host })
+		cmds = append(cmds, m.connect(msg.item, index))
+	case probeJobMsg:
+		if jb, ok := m.jobs.finish(msg.id); ok {
+			m.showJobResult(fmt.Sprintf("%q %s", jb.Item.Host, msg.result))
+		}
+	// When the connection succeeded store what was received
+	// and stop all processing
+	case connectJobMsg:
+		jb, ok := m.jobs.finish(msg.id)
+		if !ok {
+			break
+		}
+		if msg.err != nil {
+			cmds = append(cmds, m.abortConnect(jb, fmt.Sprintf("%q timed out connecting after %v", jb.Item.Host, m.connectTimeout)))
+		} else if failed := msg.exitCode == sshFailedExitCode || msg.exitCode < 0; failed && (needsInteractiveAuth(msg.stderr) || needsHostKeyConfirmation(msg.stderr)) && m.authAttempted != jb.Item.Host {
+			// Typing in a password or a code and confirming a new
+			// host key need the terminal
 			cmds = append(cmds, m.stopwatch.Stop())
 			cmds = append(cmds, m.stopwatch.Reset())
-			cmds = append(cmds, waitForCommandError(m.errorChan)) // Continue waiting for new errors
-		} else {
-			// When something was received as 'connectionErrorMsg'
-			// clear the choice from the model as the logic in
-			// 'main.go' checks it to be present
+			cmds = append(cmds, m.authenticate(jb.Item, jb.Index))
+		} else if failed {
+			failure := newConnectFailure(jb.Item, msg.stderr, msg.exitCode)
+			m.failure = &failure
 			m.choice = ""
-			m.err = strings.Join(msg, "")
-			return m, tea.Quit
-		}
-	// When something was received as 'connectionOutputMsg'
-	// store what was received and stop all processing
-	case connectionOutputMsg:
-		if m.connection.state == "Pinging" {
-			m.connection.state = "Pinged"
-			last := msg[len(msg)-1]
-			// The last line of the output is only empty when the ping did not succeed
-			if last == "" {
-				m.connection.output = fmt.Sprintf("%q could not ping", m.list.SelectedItem().(Item).Host)
-			} else {
-				m.connection.output = fmt.Sprintf("%q %s", m.list.SelectedItem().(Item).Host, last)
-			}
-			cmds = append(cmds, waitForCommandOutput(m.outputChan)) // Continue waiting for new output
+			m.connection.state = "Failed"
+			m.connection.output = failure.String()
+			cmds = append(cmds, m.stopwatch.Stop())
+			cmds = append(cmds, m.stopwatch.Reset())
+		} else if m.launchWith != nil {
+			// The session opens elsewhere and the list stays
+			m.connection.startupTime = m.stopwatch.Elapsed()
+			m.connection.phases = msg.phases
+			m.connection.state = "Launching"
+			m.choice = ""
+			m.rememberConnection(jb.Item)
+			args := append(slices.Clone(m.choiceArgs), sshControl.childOpts()...)
+			cmds = append(cmds, m.stopwatch.Stop(), m.stopwatch.Reset(), launchCommand(jb.Item, m.launchWith, args))
 		} else {
-			m.connection.output = strings.Join(msg, "\n")
+			m.connection.output = strings.Join(msg.output, "\n")
 			m.connection.startupTime = m.stopwatch.Elapsed()
+			m.connection.phases = msg.phases
 			m.connection.state = "Connected"
-			return m.recordConnection(m.list.SelectedItem().(Item))
+			return m.recordConnection(jb.Item)
+		}
+	// Marks are kept up to date whether or not the list of
+	// control masters is shown
+	case mastersMsg:
+		if msg.err != nil {
+			m.showJobResult(fmt.Sprintf("Could not list control masters: %v", msg.err))
+			break
+		}
+		if len(msg.masters) == 0 && len(m.masters) == 0 {
+			break
+		}
+		m.masters = msg.masters
+		m.masterCursor = min(m.masterCursor, max(len(m.masters)-1, 0))
+		m.originalItems = markMasters(m.originalItems, m.masters)
+		m.sortedItems = markMasters(m.sortedItems, m.masters)
+		if m.sorted {
+			cmds = append(cmds, m.list.SetItems(m.sortedItems))
+		} else {
+			cmds = append(cmds, m.list.SetItems(m.originalItems))
+		}
+	case masterControlMsg:
+		output := fmt.Sprintf("Sent %q to the control master of %q", msg.op, msg.master.Host)
+		if msg.err != nil {
+			output = fmt.Sprintf("Could not send %q to the control master of %q: %v", msg.op, msg.master.Host, msg.err)
+		}
+		m.showJobResult(output)
+		cmds = append(cmds, listMastersCommand(m.controlDir))
+	case launchedMsg:
+		m.connection.state = "Pinged"
+		m.connection.output = fmt.Sprintf("%q opened in %s after connecting in %v", msg.item.Host, msg.where, m.connection.startupTime.Round(time.Millisecond))
+		if msg.err != nil {
+			m.connection.output = fmt.Sprintf("%q could not be opened in %s: %v", msg.item.Host, msg.where, msg.err)
+		}
+	// In loop mode the list comes back once the session ends,
+	// with how it ended shown next to the host
+	case sessionDoneMsg:
+		m.choice = ""
+		m.connection.state = "Pinged"
+		if msg.err != nil {
+			m.connection.output = fmt.Sprintf("%q session could not run: %v", msg.item.Host, msg.err)
+			break
+		}
+		m.connection.output = fmt.Sprintf("%q session %s", msg.item.Host, msg.result)
+		result := msg.result
+		for n, li := range m.list.Items() {
+			if i := li.(Item); i.Host == msg.item.Host {
+				i.Session = &result
+				cmds = append(cmds, m.setItem(n, i))
+			}
+		}
+		// The list that isn't shown has the host somewhere else
+		other := m.originalItems
+		if !m.sorted {
+			other = m.sortedItems
+		}
+		for n, li := range other {
+			if i := li.(Item); i.Host == msg.item.Host {
+				i.Session = &result
+				other[n] = i
+			}
+		}
+	case sweepResultMsg:
+		m.statusCache[msg.address] = msg.status
+		for n, li := range m.originalItems {
+			i := li.(Item)
+			if i.probeAddress() != msg.address {
+				continue
+			}
+			i.Status = &msg.status
+			m.originalItems[n] = i
+			if !m.sorted {
+				cmds = append(cmds, m.list.SetItem(n, i))
+			}
+		}
+		cmds = append(cmds, waitForSweepResult(msg.results))
+	case sweepDoneMsg:
+		m.sweeper.done(msg.results)
+		if !m.sweeper.running() {
+			customKeys.Sweep.SetHelp("s", "sweep hosts")
+		}
+	case liveResultMsg:
+		// Results may still arrive from a live ping that was left
+		if m.live != nil && msg.results == m.live.results {
+			m.live.record(msg.status)
+			cmds = append(cmds, waitForLiveResult(msg.results))
 		}
 	case spinner.TickMsg:
 		m.pingSpinner, cmd = m.pingSpinner.Update(msg)
@@ -422,17 +744,35 @@ func (m model) View() tea.View {
 		style    lipgloss.Style
 	)
 
-	if m.connection.state == "Connecting" {
-		v := tea.NewView(fmt.Sprintf("\n\n   %s Connecting... %s\n\n", m.spinner.View(), m.stopwatch.View()))
+	// The list of jobs comes first as connecting can be
+	// canceled from there
+	if m.showJobs {
+		v := tea.NewView(docStyle.Render(m.jobs.view(m.jobCursor)))
+		v.AltScreen = true
+		return v
+	} else if m.showMasters {
+		v := tea.NewView(docStyle.Render(mastersView(m.masters, m.masterCursor)))
+		v.AltScreen = true
+		return v
+	} else if m.connection.state == "Failed" || m.connection.state == "Replacing" {
+		v := tea.NewView(docStyle.Render(m.failure.view(m.list.Width())))
+		v.AltScreen = true
+		return v
+	} else if m.connection.state == "LivePinging" {
+		v := tea.NewView(docStyle.Render(m.live.view()))
+		v.AltScreen = true
+		return v
+	} else if m.connection.state == "Connecting" {
+		v := tea.NewView(fmt.Sprintf("\n\n   %s Connecting... %s\n\n%s   %s\n", m.spinner.View(), m.stopwatch.View(), phasesView(m.connection.phases), versionStyle("esc cancel")))
 		v.AltScreen = true
 		return v
 	} else if m.connection.state == "Connected" {
 		return tea.NewView(style.Render(view))
 	}
 
-	if m.connection.state == "Pinging" {
-		m.list.NewStatusMessage(fmt.Sprintf("%s %s", m.pingSpinner.View(), versionStyle(fmt.Sprintf("Pinging %q %s times", m.list.SelectedItem().(Item).Host, m.pingOpts[len(m.pingOpts)-1]))))
-	} else if m.connection.state == "Pinged" || m.connection.state == "Copying" || m.connection.state == "Sorting" {
+	if m.connection.state == "Running" {
+		m.list.NewStatusMessage(fmt.Sprintf("%s %s", m.pingSpinner.View(), versionStyle(m.jobs.status())))
+	} else if m.connection.state == "Pinged" || m.connection.state == "Copying" || m.connection.state == "Sorting" || m.connection.state == "Warning" || m.connection.state == "Reloaded" {
 		m.list.NewStatusMessage(versionStyle(m.connection.output))
 	} else {
 		m.list.NewStatusMessage(versionStyle(pkgVersion()))
@@ -478,6 +818,10 @@ func (m model) View() tea.View {
 }
 
 func (m model) quitProgram() (tea.Model, tea.Cmd) {
+	if m.live != nil {
+		m.live.stop()
+	}
+	m.jobs.cancelAll()
 	// Clear the output just in case something was stored
 	m.connection.output = ""
 	m.choice = ""
@@ -495,7 +839,11 @@ func (m model) updateCustomInput(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.connectInput.Blur()
 			m.list.SetDelegate(m.defaultDelegate)
 		case "enter":
+			m.connectInput.Blur()
+			m.list.SetDelegate(m.defaultDelegate)
 			m.choice = m.connectInput.Value()
+			m.connectInput.SetValue("")
+			m.choiceArgs = []string{m.choice}
 			i := Item{Host: m.choice, Hostname: m.choice}
 			return m.recordConnection(i)
 		}
@@ -505,6 +853,191 @@ func (m model) updateCustomInput(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// updateLivePing updates the model's state based on the keys
+// for leaving live ping mode, which stops the probing.
+func (m model) updateLivePing(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyPressMsg:
+		switch {
+		case msg.String() == "ctrl+c":
+			return m.quitProgram()
+		case msg.String() == "esc", msg.String() == "q", key.Matches(msg, customKeys.Live):
+			m.live.stop()
+			m.connection.state = "Pinged"
+			m.connection.output = fmt.Sprintf("%q %s", m.live.item.Host, m.live)
+			m.live = nil
+		}
+	}
+	return m, nil
+}
+
+// updateJobs updates the model's state based on the keys for
+// choosing and canceling jobs in the list of jobs.
+func (m model) updateJobs(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmds []tea.Cmd
+	switch msg := msg.(type) {
+	case tea.KeyPressMsg:
+		switch keypress := msg.String(); {
+		case keypress == "ctrl+c":
+			return m.quitProgram()
+		case keypress == "esc", keypress == "q", key.Matches(msg, customKeys.Jobs):
+			m.showJobs = false
+		case keypress == "up", keypress == "k":
+			m.jobCursor = max(m.jobCursor-1, 0)
+		case keypress == "down", keypress == "j":
+			m.jobCursor = min(m.jobCursor+1, max(len(m.jobs.jobs)-1, 0))
+		case keypress == "x":
+			if m.jobCursor >= len(m.jobs.jobs) {
+				break
+			}
+			jb := m.jobs.jobs[m.jobCursor]
+			m.jobs.cancel(jb.ID)
+			m.jobCursor = min(m.jobCursor, max(len(m.jobs.jobs)-1, 0))
+			output := fmt.Sprintf("Canceled job #%d: %s", jb.ID, jb.Description)
+			if jb.Kind == connectJob {
+				cmds = append(cmds, m.abortConnect(jb, output))
+			} else {
+				m.showJobResult(output)
+			}
+		}
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// updateMasters updates the model's state based on the keys
+// for choosing, stopping, and exiting control masters in the
+// list of control masters.
+func (m model) updateMasters(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmds []tea.Cmd
+	switch msg := msg.(type) {
+	case tea.KeyPressMsg:
+		switch keypress := msg.String(); {
+		case keypress == "ctrl+c":
+			return m.quitProgram()
+		case keypress == "esc", keypress == "q", key.Matches(msg, customKeys.Masters):
+			m.showMasters = false
+		case keypress == "up", keypress == "k":
+			m.masterCursor = max(m.masterCursor-1, 0)
+		case keypress == "down", keypress == "j":
+			m.masterCursor = min(m.masterCursor+1, max(len(m.masters)-1, 0))
+		case keypress == "r":
+			cmds = append(cmds, listMastersCommand(m.controlDir))
+		case keypress == "s", keypress == "x":
+			if m.masterCursor >= len(m.masters) {
+				break
+			}
+			op := "stop"
+			if keypress == "x" {
+				op = "exit"
+			}
+			cmds = append(cmds, masterControlCommand(m.masters[m.masterCursor], op))
+		}
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// connectSelected starts connecting to the selected host, unless
+// it's known to prompt when authenticating, in which case that is
+// done first. It returns the command doing so, if any.
+func (m *model) connectSelected() tea.Cmd {
+	i, ok := m.list.SelectedItem().(Item)
+	if !ok {
+		return nil
+	}
+	if m.sorted {
+		i = m.loadedItem(i)
+	}
+	if m.interactiveHosts != "" && matchPatternList(i.Host, m.interactiveHosts) {
+		return m.authenticate(i, m.list.GlobalIndex())
+	}
+	m.authAttempted = ""
+	return m.connect(i, m.list.GlobalIndex())
+}
+
+// loadedItem returns the host loaded from the sources that a
+// recently used 'i' refers to, as only its names are remembered
+// and connecting to hosts from an inventory also needs their
+// user, port, and variables. Hosts that are no longer in any of
+// the sources, like those connected to ad hoc, are returned as is.
+func (m *model) loadedItem(i Item) Item {
+	for _, li := range m.originalItems {
+		if loaded := li.(Item); loaded.Host == i.Host && loaded.Hostname == i.Hostname {
+			return loaded
+		}
+	}
+	return i
+}
+
+// connect starts connecting to 'i', which is at 'index' of the
+// unfiltered list, in the background and returns the command
+// doing so.
+func (m *model) connect(i Item, index int) tea.Cmd {
+	m.connection.state = "Connecting"
+	m.connection.phases = nil
+	m.choice = i.Host
+	m.choiceArgs = i.connectArgs()
+	opts := append(slices.Clone(m.choiceArgs), m.sshOpts...)
+	// Nothing can be typed in while in the background
+	opts = append(opts, backgroundOpts(i)...)
+	opts = append(opts, sshControl.parentOpts(i)...)
+	jb, ctx := m.jobs.start(connectJob, i, index, fmt.Sprintf("Connecting to %q", i.Host))
+	jb.Args = opts
+	return tea.Batch(m.spinner.Tick, m.stopwatch.Init(), connectCommand(ctx, jb.ID, opts, m.connectTimeout))
+}
+
+// authenticate hands the terminal over to SSH for authenticating
+// to 'i', which is at 'index' of the unfiltered list, after which
+// connecting goes on as usual through the control master.
+func (m *model) authenticate(i Item, index int) tea.Cmd {
+	m.connection.state = "Authenticating"
+	m.authAttempted = i.Host
+	return authCommand(i, index, m.sshOpts)
+}
+
+// updateConnecting updates the model's state based on the keys
+// for canceling the connection that is being made.
+func (m model) updateConnecting(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyPressMsg:
+		switch {
+		case msg.String() == "esc", msg.String() == "ctrl+c":
+			jb, ok := m.jobs.byKind(connectJob)
+			if !ok {
+				break
+			}
+			m.jobs.cancel(jb.ID)
+			return m, m.abortConnect(jb, fmt.Sprintf("Canceled connecting to %q", jb.Item.Host))
+		case key.Matches(msg, customKeys.Jobs):
+			m.showJobs = true
+			m.jobCursor = 0
+		}
+	}
+	return m, nil
+}
+
+// abortConnect returns the model to the list after the
+// connection made by 'jb' was cut short, showing 'output' in
+// the status bar, and returns a command that removes the
+// control socket that may have been left behind.
+func (m *model) abortConnect(jb *job, output string) tea.Cmd {
+	// Nothing is left to connect to, so 'main.go' must not
+	// find a choice either
+	m.choice = ""
+	m.connection.state = "Pinged"
+	m.connection.output = output
+	return tea.Batch(m.stopwatch.Stop(), m.stopwatch.Reset(), cleanupCommand(jb.Args))
+}
+
+// showJobResult shows 'output' in the status bar unless a
+// connection is being made, in which case it's of no interest.
+func (m *model) showJobResult(output string) {
+	if m.connection.state == "Connecting" || m.connection.state == "LivePinging" {
+		return
+	}
+	m.connection.state = "Pinged"
+	m.connection.output = output
+}
+
 // unsort updates the model's state to the original list of items.
 func (m model) unsort(msg tea.Msg) (tea.Model, tea.Cmd) {
 	m.sorted = false
@@ -524,11 +1057,45 @@ func (m model) sort(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// setItem replaces the item at 'index' of the unfiltered list
+// with 'i', also replacing it in whichever of the original and
+// sorted items are currently shown.
+func (m *model) setItem(index int, i Item) tea.Cmd {
+	if m.sorted {
+		m.sortedItems[index] = i
+	} else {
+		m.originalItems[index] = i
+	}
+	return m.list.SetItem(index, i)
+}
+
 // recordConnection adjusts the sorted list of items to bring
 // to the front the most recently chosen item and writes the
-// result to disk.
+// result to disk. The program then quits for 'main.go' to start
+// the session, unless in loop mode where the session is started
+// from here.
 func (m model) recordConnection(i Item) (tea.Model, tea.Cmd) {
-	items := timestampFirstItem(itemToFront(m.sortedItems, i))
-	itemsToJson(m.recentlyUsedPath, items, true)
-	return m, tea.Quit
+	if !m.loop {
+		items := timestampFirstItem(itemToFront(m.sortedItems, i))
+		itemsToJson(m.recentlyUsedPath, items, true)
+		return m, tea.Quit
+	}
+
+	m.rememberConnection(i)
+	m.connection.state = "Session"
+	args := append(slices.Clone(m.choiceArgs), sshControl.childOpts()...)
+	return m, tea.Batch(m.stopwatch.Stop(), m.stopwatch.Reset(), sessionCommand(i, args, m.connection.summary()))
+}
+
+// rememberConnection brings 'i' to the front of the recently used
+// hosts and writes them to disk for when the program goes on after
+// connecting.
+func (m *model) rememberConnection(i Item) {
+	m.sortedItems = timestampFirstItem(itemToFront(m.sortedItems, i))
+	itemsToJson(m.recentlyUsedPath, m.sortedItems, true)
+	if m.sorted {
+		// The host is now the first of the recently used
+		m.list.SetItems(m.sortedItems)
+		m.list.Select(0)
+	}
 }
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+)
+
+// Patterns matching the parts of the warning SSH prints when a host key
+// changed that are needed for removing the old key.
+var (
+	newKeyPattern       = regexp.MustCompile(`The fingerprint for the (\S+) key sent by the remote host is\s+(\S+?)\.?\s*$`)
+	offendingKeyPattern = regexp.MustCompile(`Offending (\S+) key in (.+):(\d+)`)
+	removeHostPattern   = regexp.MustCompile(`ssh-keygen -f .* -R ['"]?([^'"\s]+)['"]?`)
+)
+
+// A hostKeyMismatch describes a host key that is different from the one
+// in a known_hosts file.
+//
+// Host is what the old key is known as, which is what 'ssh-keygen -R'
+// needs. It's in the form '[host]:port' for hosts on other ports.
+type hostKeyMismatch struct {
+	Host           string
+	KeyType        string
+	NewFingerprint string
+	OldFingerprint string
+	File           string
+	Line           int
+}
+
+// parseHostKeyMismatch returns what the warning SSH printed to 'stderr'
+// says about the host key that changed. An error is returned when it
+// doesn't say where the old key is.
+func parseHostKeyMismatch(stderr string) (hostKeyMismatch, error) {
+	var mismatch hostKeyMismatch
+	scanner := bufio.NewScanner(strings.NewReader(strings.ReplaceAll(stderr, "\r\n", "\n")))
+	// The new fingerprint is on the line after the one introducing it
+	var previous string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := newKeyPattern.FindStringSubmatch(previous + " " + line); m != nil && mismatch.NewFingerprint == "" {
+			mismatch.KeyType, mismatch.NewFingerprint = m[1], m[2]
+		}
+		if m := offendingKeyPattern.FindStringSubmatch(line); m != nil {
+			mismatch.File = m[2]
+			mismatch.Line, _ = strconv.Atoi(m[3])
+		}
+		if m := removeHostPattern.FindStringSubmatch(line); m != nil {
+			mismatch.Host = m[1]
+		}
+		previous = line
+	}
+
+	if mismatch.File == "" || mismatch.Line == 0 || mismatch.Host == "" {
+		return hostKeyMismatch{}, errors.New("no offending key found")
+	}
+	mismatch.OldFingerprint, _ = knownHostFingerprint(mismatch.File, mismatch.Line)
+	return mismatch, nil
+}
+
+// knownHostFingerprint returns the SHA256 fingerprint of the key on line
+// 'n' of the known_hosts file at 'filePath', in the same form SSH shows.
+func knownHostFingerprint(filePath string, n int) (string, error) {
+	fields, err := knownHostFields(filePath, n)
+	if err != nil {
+		return "", err
+	}
+	fingerprint, err := keyFingerprint(fields[2])
+	if err != nil {
+		return "", fmt.Errorf("could not decode key on line %d in file '%s': %w", n, filePath, err)
+	}
+	return fingerprint, nil
+}
+
+// knownHostFields returns the hosts, key type, and key on line 'n' of the
+// known_hosts file at 'filePath', along with anything following them.
+func knownHostFields(filePath string, n int) ([]string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	lines := bytes.Split(content, []byte("\n"))
+	if n < 1 || n > len(lines) {
+		return nil, fmt.Errorf("no line %d in file '%s'", n, filePath)
+	}
+
+	fields := strings.Fields(string(lines[n-1]))
+	// Keys marked as '@cert-authority' or '@revoked' have a field more
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+		fields = fields[1:]
+	}
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("no key on line %d in file '%s'", n, filePath)
+	}
+	return fields, nil
+}
+
+// hashedHostPrefix is how hosts hashed with 'HashKnownHosts' start.
+const hashedHostPrefix = "|1|"
+
+// hashKnownHost returns 'host' hashed in the same way SSH does with
+// 'HashKnownHosts', using a random salt.
+func hashKnownHost(host string) (string, error) {
+	salt := make([]byte, sha1.Size)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return hashedHostPrefix + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// keyFingerprint returns the SHA256 fingerprint of the base64 encoded 'key',
+// in the same form SSH shows.
+func keyFingerprint(key string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(decoded)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+// hostKeyScanTimeout is how long the keys of a host may take to scan.
+const hostKeyScanTimeout = 10 * time.Second
+
+// scanHostKeysArgs returns the command and its arguments that list the keys
+// presented by 'i' in the form of known_hosts lines. Hosts behind a jump
+// host are scanned from the last one in the chain, as that is where SSH
+// connects to them from.
+func scanHostKeysArgs(i Item, sshOpts []string) (string, []string) {
+	host, port, _ := net.SplitHostPort(i.probeAddress())
+	scan := []string{"ssh-keyscan", "-T", "5", "-p", port, host}
+	if i.ProxyJump == "" || i.ProxyJump == "none" {
+		return scan[0], scan[1:]
+	}
+	return sshExecutableName, append(lastHopArgs(i.ProxyJump, sshOpts), scan...)
+}
+
+// confirmedKeyLine returns the known_hosts line for the mismatched host with
+// whichever of the 'scanned' keys has the fingerprint that was confirmed.
+// An error is returned when none of them have it.
+func confirmedKeyLine(scanned []byte, mismatch hostKeyMismatch) (string, error) {
+	for _, line := range strings.Split(string(scanned), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fingerprint, err := keyFingerprint(fields[2]); err == nil && fingerprint == mismatch.NewFingerprint {
+			return strings.Join([]string{mismatch.Host, fields[1], fields[2]}, " "), nil
+		}
+	}
+	return "", fmt.Errorf("the host no longer presents the key %s that was confirmed", mismatch.NewFingerprint)
+}
+
+// A hostKeyReplacedMsg indicates that the old key of 'item' was replaced
+// with the one that was confirmed, or the error that prevented it.
+type hostKeyReplacedMsg struct {
+	item Item
+	err  error
+}
+
+// replaceHostKeyCommand returns a command that replaces the old key of the
+// mismatched host with the new one that was confirmed. The keys the host
+// presents are scanned first and nothing is changed unless one of them has
+// the confirmed fingerprint. Every key of the host is then removed from its
+// known_hosts file with 'ssh-keygen -R', which also takes care of hashed
+// hosts and keeps a backup of the file, and the confirmed key is added, so
+// connecting again checks the host key as strictly as ever.
+func replaceHostKeyCommand(i Item, mismatch hostKeyMismatch, sshOpts []string) tea.Cmd {
+	return func() tea.Msg {
+		return hostKeyReplacedMsg{item: i, err: replaceHostKey(i, mismatch, sshOpts)}
+	}
+}
+
+func replaceHostKey(i Item, mismatch hostKeyMismatch, sshOpts []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hostKeyScanTimeout)
+	defer cancel()
+	name, args := scanHostKeysArgs(i, sshOpts)
+	scanned, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return fmt.Errorf("could not scan host keys: %w", err)
+	}
+	line, err := confirmedKeyLine(scanned, mismatch)
+	if err != nil {
+		return err
+	}
+	return pinHostKey(mismatch, line)
+}
+
+// pinHostKey replaces every key of the mismatched host in its known_hosts
+// file with the known_hosts 'line' of the confirmed key. The host is hashed
+// when the old key had its host hashed, as the file is then kept that way.
+func pinHostKey(mismatch hostKeyMismatch, line string) error {
+	if fields, err := knownHostFields(mismatch.File, mismatch.Line); err == nil && strings.HasPrefix(fields[0], hashedHostPrefix) {
+		hashed, err := hashKnownHost(mismatch.Host)
+		if err != nil {
+			return err
+		}
+		_, rest, _ := strings.Cut(line, " ")
+		line = hashed + " " + rest
+	}
+
+	out, err := exec.Command("ssh-keygen", "-f", mismatch.File, "-R", mismatch.Host).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	f, err := os.OpenFile(mismatch.File, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,755 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"charm.land/bubbles/v2/list"
+	"gopkg.in/yaml.v3"
+)
+
+// An inventory is an Ansible inventory made up of hosts, the groups they
+// belong to, and the variables set for both, along with the line each host
+// was first found on when it's known.
+//
+// Every inventory has the implicit groups 'all', which every other group is
+// a child of, and 'ungrouped', which holds hosts without any other group.
+type inventory struct {
+	hosts    []string
+	hostVars map[string]map[string]string
+	lines    map[string]int
+	groups   map[string]*inventoryGroup
+}
+
+// An inventoryGroup is a group within an Ansible inventory.
+type inventoryGroup struct {
+	hosts    []string
+	children []string
+	vars     map[string]string
+}
+
+// Names of the groups implicitly present in every inventory.
+const (
+	inventoryAllGroup       = "all"
+	inventoryUngroupedGroup = "ungrouped"
+)
+
+// newInventory returns an empty 'inventory'.
+func newInventory() *inventory {
+	return &inventory{
+		hostVars: make(map[string]map[string]string),
+		lines:    make(map[string]int),
+		groups:   make(map[string]*inventoryGroup),
+	}
+}
+
+// group returns the group called 'name', creating it if needed.
+func (inv *inventory) group(name string) *inventoryGroup {
+	g, ok := inv.groups[name]
+	if !ok {
+		g = &inventoryGroup{vars: make(map[string]string)}
+		inv.groups[name] = g
+	}
+	return g
+}
+
+// addHost adds host 'name' found on 'line' to 'group' with the given host
+// variables 'vars', which are merged with any variables the host already
+// had. Hosts from formats without lines are given line 0.
+func (inv *inventory) addHost(group, name string, vars map[string]string, line int) {
+	if _, ok := inv.hostVars[name]; !ok {
+		inv.hosts = append(inv.hosts, name)
+		inv.hostVars[name] = make(map[string]string)
+		inv.lines[name] = line
+	}
+	for k, v := range vars {
+		inv.hostVars[name][k] = v
+	}
+
+	g := inv.group(group)
+	if !slices.Contains(g.hosts, name) {
+		g.hosts = append(g.hosts, name)
+	}
+}
+
+// addChild makes group 'child' a child of group 'parent'.
+func (inv *inventory) addChild(parent, child string) {
+	inv.group(child)
+	g := inv.group(parent)
+	if !slices.Contains(g.children, child) {
+		g.children = append(g.children, child)
+	}
+}
+
+// parents returns a map of each group to the groups it is a child of, where
+// every group without a parent is a child of 'all'.
+func (inv *inventory) parents() map[string][]string {
+	parents := make(map[string][]string)
+	for name, g := range inv.groups {
+		for _, child := range g.children {
+			parents[child] = append(parents[child], name)
+		}
+	}
+	for name := range inv.groups {
+		if name != inventoryAllGroup && len(parents[name]) == 0 {
+			parents[name] = []string{inventoryAllGroup}
+		}
+	}
+	return parents
+}
+
+// hostGroups returns every group 'host' belongs to either directly or
+// through a child group, sorted the way Ansible applies their variables:
+// 'all' first and the rest from the most distant to the closest to the host,
+// then by name.
+func (inv *inventory) hostGroups(host string, parents map[string][]string) []string {
+	depth := make(map[string]int)
+	var visit func(name string, d int)
+	visit = func(name string, d int) {
+		if seen, ok := depth[name]; ok && seen >= d {
+			return
+		}
+		depth[name] = d
+		for _, p := range parents[name] {
+			visit(p, d-1)
+		}
+	}
+
+	for name, g := range inv.groups {
+		if slices.Contains(g.hosts, host) {
+			visit(name, 0)
+		}
+	}
+
+	groups := []string{inventoryAllGroup}
+	for name := range depth {
+		if name != inventoryAllGroup {
+			groups = append(groups, name)
+		}
+	}
+	slices.SortFunc(groups[1:], func(a, b string) int {
+		if depth[a] != depth[b] {
+			return depth[a] - depth[b]
+		}
+		return strings.Compare(a, b)
+	})
+	return groups
+}
+
+// items returns a slice of 'list.Item' for every host in the inventory in
+// the order they first appear, each carrying its groups and the variables
+// that apply to it.
+//
+// Variables are applied from the least specific to the most specific group
+// with host variables applied last, so they take precedence as in Ansible.
+func (inv *inventory) items(switchFilter bool) []list.Item {
+	parents := inv.parents()
+
+	var items []list.Item
+	for _, host := range inv.hosts {
+		vars := make(map[string]string)
+		var groups []string
+		for _, name := range inv.hostGroups(host, parents) {
+			if g, ok := inv.groups[name]; ok {
+				for k, v := range g.vars {
+					vars[k] = v
+				}
+			}
+			if name != inventoryAllGroup && name != inventoryUngroupedGroup {
+				groups = append(groups, name)
+			}
+		}
+		for k, v := range inv.hostVars[host] {
+			vars[k] = v
+		}
+		slices.Sort(groups)
+
+		i := newInventoryItem(host, groups, vars, switchFilter)
+		i.Origins[0].Line = inv.lines[host]
+		items = append(items, i)
+	}
+	return items
+}
+
+// newInventoryItem returns an 'Item' for inventory host 'name' with fields
+// filled in from its connection variables, including the older 'ansible_ssh_'
+// variants of them.
+//
+// As with the host lines themselves, the host connected to is the value of
+// 'ansible_host' when present, with the inventory name kept as Hostname.
+func newInventoryItem(name string, groups []string, vars map[string]string, switchFilter bool) Item {
+	i := Item{Host: name, Hostname: name, Groups: groups, Vars: vars, Origins: []itemOrigin{{Source: inventorySource}}, SwitchFilter: switchFilter}
+	if host := firstVar(vars, "ansible_host", "ansible_ssh_host"); host != "" {
+		i.Host = host
+	}
+	i.User = firstVar(vars, "ansible_user", "ansible_ssh_user")
+	i.Port = firstVar(vars, "ansible_port", "ansible_ssh_port")
+	return i
+}
+
+// firstVar returns the value of the first of 'names' set in 'vars'.
+func firstVar(vars map[string]string, names ...string) string {
+	for _, n := range names {
+		if v, ok := vars[n]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseIniInventory returns an 'inventory' from the given 'content' slice of
+// bytes in the INI format of Ansible inventories.
+//
+// Sections named '[group]' list hosts along with their variables, sections
+// named '[group:children]' list child groups, and sections named
+// '[group:vars]' set group variables. Hosts listed before any section are
+// ungrouped. Host names may contain ranges like 'web[01:20].example.com'.
+func parseIniInventory(content []byte) (*inventory, error) {
+	inv := newInventory()
+	group, kind := inventoryUngroupedGroup, "hosts"
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			group, kind, _ = strings.Cut(line[1:len(line)-1], ":")
+			if kind == "" {
+				kind = "hosts"
+			}
+			if kind != "hosts" && kind != "vars" && kind != "children" {
+				return nil, fmt.Errorf("line %d: unknown section type '%s'", n, kind)
+			}
+			inv.group(group)
+			continue
+		}
+
+		switch kind {
+		case "vars":
+			k, v, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected 'key=value' in '%s:vars'", n, group)
+			}
+			inv.group(group).vars[strings.TrimSpace(k)] = unquoteIniValue(strings.TrimSpace(v))
+		case "children":
+			inv.addChild(group, line)
+		default:
+			if err := parseIniHostLine(inv, group, line, n); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+		}
+	}
+
+	return inv, nil
+}
+
+// parseIniHostLine adds the hosts found on a single host 'line' of an INI
+// inventory, which is line number 'n', to 'group'. The line is split in the
+// same way as arguments in an SSH configuration, which handles both quoting
+// and comments.
+func parseIniHostLine(inv *inventory, group, line string, n int) error {
+	fields, err := splitSshConfigArgs(line)
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	vars := make(map[string]string)
+	for _, f := range fields[1:] {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok {
+			return fmt.Errorf("expected 'key=value' after host, got '%s'", f)
+		}
+		vars[k] = v
+	}
+
+	return inv.addHostPattern(group, fields[0], vars, n)
+}
+
+// addHostPattern adds every host described by 'pattern' on 'line' to 'group'
+// with the given host variables 'vars'. The pattern may contain ranges as
+// well as a port, which is used for 'ansible_port' unless that's already set.
+func (inv *inventory) addHostPattern(group, pattern string, vars map[string]string, line int) error {
+	name, port := splitInventoryHostPort(pattern)
+	if _, ok := vars["ansible_port"]; !ok && port != "" {
+		vars["ansible_port"] = port
+	}
+
+	names, err := expandHostRange(name)
+	if err != nil {
+		return err
+	}
+	for _, h := range names {
+		inv.addHost(group, h, vars, line)
+	}
+	return nil
+}
+
+// splitInventoryHostPort splits an inventory host pattern of the form
+// 'host:port' or '[host]:port' into its host and port. Colons within ranges
+// are disregarded, and patterns without a port, including bare IPv6
+// addresses, are returned as they are.
+func splitInventoryHostPort(pattern string) (string, string) {
+	colon, colons, depth := -1, 0, 0
+	for i, c := range pattern {
+		switch {
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == ':' && depth == 0:
+			colon = i
+			colons++
+		}
+	}
+	if colons != 1 {
+		return pattern, ""
+	}
+	if _, err := strconv.Atoi(pattern[colon+1:]); err != nil {
+		return pattern, ""
+	}
+
+	host := pattern[:colon]
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") && strings.Contains(host, "::") {
+		host = host[1 : len(host)-1]
+	}
+	return host, pattern[colon+1:]
+}
+
+// unquoteIniValue returns 'v' without its surrounding quotes if it has any.
+func unquoteIniValue(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// expandHostRange returns every host name described by 'pattern', which may
+// contain ranges of the form '[start:end]' or '[start:end:stride]'. Numeric
+// ranges keep leading zeros and alphabetic ranges go through single letters,
+// e.g. 'web[01:03]' gives 'web01', 'web02', and 'web03'.
+func expandHostRange(pattern string) ([]string, error) {
+	start := strings.Index(pattern, "[")
+	end := strings.Index(pattern, "]")
+	if start == -1 || end < start || !strings.Contains(pattern[start:end], ":") {
+		return []string{pattern}, nil
+	}
+
+	head, body, tail := pattern[:start], pattern[start+1:end], pattern[end+1:]
+	bounds := strings.Split(body, ":")
+	if len(bounds) > 3 || bounds[0] == "" || bounds[1] == "" {
+		return nil, fmt.Errorf("invalid range '[%s]' in '%s'", body, pattern)
+	}
+	stride := 1
+	if len(bounds) == 3 {
+		s, err := strconv.Atoi(bounds[2])
+		if err != nil || s < 1 {
+			return nil, fmt.Errorf("invalid stride '%s' in '%s'", bounds[2], pattern)
+		}
+		stride = s
+	}
+
+	var values []string
+	first, errFirst := strconv.Atoi(bounds[0])
+	last, errLast := strconv.Atoi(bounds[1])
+	switch {
+	case errFirst == nil && errLast == nil:
+		width := 0
+		if len(bounds[0]) > 1 && bounds[0][0] == '0' {
+			width = len(bounds[0])
+		}
+		for v := first; v <= last; v += stride {
+			values = append(values, fmt.Sprintf("%0*d", width, v))
+		}
+	case isAsciiLetter(bounds[0]) && isAsciiLetter(bounds[1]) && bounds[0] <= bounds[1]:
+		for c := bounds[0][0]; c <= bounds[1][0]; c += byte(stride) {
+			values = append(values, string(c))
+			if int(c)+stride > 255 {
+				break
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid range '[%s]' in '%s'", body, pattern)
+	}
+
+	var hosts []string
+	for _, v := range values {
+		rest, err := expandHostRange(tail)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rest {
+			hosts = append(hosts, head+v+r)
+		}
+	}
+	return hosts, nil
+}
+
+// isAsciiLetter reports whether 's' is a single ASCII letter.
+func isAsciiLetter(s string) bool {
+	return len(s) == 1 && ('a' <= s[0] && s[0] <= 'z' || 'A' <= s[0] && s[0] <= 'Z')
+}
+
+// parseYamlInventory returns an 'inventory' from the given 'content' slice of
+// bytes in the YAML format of Ansible inventories, where each top-level key
+// is a group (usually just 'all') that may have 'hosts', 'vars', and nested
+// 'children' groups of its own.
+//
+// The document is decoded node by node so hosts keep the order they appear
+// in, just like with the INI format.
+func parseYamlInventory(content []byte) (*inventory, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+
+	inv := newInventory()
+	if len(doc.Content) == 0 {
+		return inv, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping of groups", root.Line)
+	}
+	for n := 0; n+1 < len(root.Content); n += 2 {
+		if err := parseYamlGroup(inv, root.Content[n].Value, root.Content[n+1]); err != nil {
+			return nil, err
+		}
+	}
+	return inv, nil
+}
+
+// parseYamlGroup adds group 'name' described by 'node' to the inventory
+// along with its hosts, variables, and children.
+func parseYamlGroup(inv *inventory, name string, node *yaml.Node) error {
+	inv.group(name)
+	if isYamlNull(node) {
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping for group '%s'", node.Line, name)
+	}
+
+	for n := 0; n+1 < len(node.Content); n += 2 {
+		key, value := node.Content[n], node.Content[n+1]
+		if isYamlNull(value) {
+			continue
+		}
+		if value.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: expected a mapping for '%s' of group '%s'", value.Line, key.Value, name)
+		}
+
+		switch key.Value {
+		case "hosts":
+			for h := 0; h+1 < len(value.Content); h += 2 {
+				vars, err := yamlVars(value.Content[h+1])
+				if err != nil {
+					return err
+				}
+				if err := inv.addHostPattern(name, value.Content[h].Value, vars, value.Content[h].Line); err != nil {
+					return fmt.Errorf("line %d: %w", value.Content[h].Line, err)
+				}
+			}
+		case "vars":
+			vars, err := yamlVars(value)
+			if err != nil {
+				return err
+			}
+			for k, v := range vars {
+				inv.group(name).vars[k] = v
+			}
+		case "children":
+			for c := 0; c+1 < len(value.Content); c += 2 {
+				child := value.Content[c].Value
+				inv.addChild(name, child)
+				if err := parseYamlGroup(inv, child, value.Content[c+1]); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("line %d: unknown key '%s' in group '%s'", key.Line, key.Value, name)
+		}
+	}
+	return nil
+}
+
+// yamlVars returns the variables in the mapping 'node'. Scalar values are
+// kept as they are, while lists and mappings are kept in their flow style.
+func yamlVars(node *yaml.Node) (map[string]string, error) {
+	vars := make(map[string]string)
+	if isYamlNull(node) {
+		return vars, nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping of variables", node.Line)
+	}
+
+	for n := 0; n+1 < len(node.Content); n += 2 {
+		value := node.Content[n+1]
+		if value.Kind == yaml.ScalarNode {
+			vars[node.Content[n].Value] = value.Value
+			continue
+		}
+		value.Style = yaml.FlowStyle
+		out, err := yaml.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		vars[node.Content[n].Value] = strings.TrimSpace(string(out))
+	}
+	return vars, nil
+}
+
+// isYamlNull reports whether 'node' is empty or an explicit null, both of
+// which are commonly used for hosts without any variables.
+func isYamlNull(node *yaml.Node) bool {
+	return node == nil || node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+// parseJsonInventory returns an 'inventory' from the given 'content' slice of
+// bytes in either of the JSON formats accepted from inventory commands:
+//
+//   - the output of 'ansible-inventory --list', which is an object of groups
+//     with their 'hosts', 'vars', and 'children' next to '_meta.hostvars'
+//     holding the variables of every host
+//   - an array of hosts, each an object with a 'host' name and optionally a
+//     'hostname', 'user', 'port', 'groups', and 'vars'
+func parseJsonInventory(content []byte) (*inventory, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+
+	var payload any
+	if err := dec.Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	switch p := payload.(type) {
+	case []any:
+		return parseJsonHostList(p)
+	case map[string]any:
+		return parseJsonGroups(p)
+	}
+	return nil, errors.New("expected either an object of groups or an array of hosts")
+}
+
+// parseJsonHostList returns an 'inventory' from a simple array of hosts.
+// The 'host' of each is its inventory name and 'hostname' its address, which
+// is what 'ansible_host' is for, so the address ends up as the title in the
+// same way as for hosts of any other inventory.
+func parseJsonHostList(hosts []any) (*inventory, error) {
+	inv := newInventory()
+	for n, h := range hosts {
+		entry, ok := h.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("host %d: expected an object", n)
+		}
+		name := jsonString(entry["host"])
+		if name == "" {
+			return nil, fmt.Errorf("host %d: missing 'host'", n)
+		}
+
+		vars := jsonVars(entry["vars"])
+		for key, v := range map[string]string{"hostname": "ansible_host", "user": "ansible_user", "port": "ansible_port"} {
+			if value := jsonString(entry[key]); value != "" {
+				vars[v] = value
+			}
+		}
+
+		groups := jsonStrings(entry["groups"])
+		if len(groups) == 0 {
+			groups = []string{inventoryUngroupedGroup}
+		}
+		for _, g := range groups {
+			inv.addHost(g, name, vars, 0)
+		}
+	}
+	return inv, nil
+}
+
+// parseJsonGroups returns an 'inventory' from an object of groups in the
+// format of 'ansible-inventory --list'.
+//
+// Groups are walked starting from 'all' in the order their children are
+// listed so hosts keep a stable order, with any groups not reachable from
+// 'all' following in alphabetical order.
+func parseJsonGroups(groups map[string]any) (*inventory, error) {
+	inv := newInventory()
+
+	hostVars := make(map[string]map[string]string)
+	if meta, ok := groups["_meta"].(map[string]any); ok {
+		if hv, ok := meta["hostvars"].(map[string]any); ok {
+			for host, vars := range hv {
+				hostVars[host] = jsonVars(vars)
+			}
+		}
+	}
+
+	visited := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		inv.group(name)
+
+		var hosts, children []string
+		switch g := groups[name].(type) {
+		case []any:
+			// Groups may also be given as just a list of hosts
+			hosts = jsonStrings(g)
+		case map[string]any:
+			hosts = jsonStrings(g["hosts"])
+			children = jsonStrings(g["children"])
+			for k, v := range jsonVars(g["vars"]) {
+				inv.group(name).vars[k] = v
+			}
+		}
+
+		for _, h := range hosts {
+			inv.addHost(name, h, hostVars[h], 0)
+		}
+		for _, c := range children {
+			inv.addChild(name, c)
+			visit(c)
+		}
+	}
+
+	visit(inventoryAllGroup)
+	var rest []string
+	for name := range groups {
+		if name != "_meta" {
+			rest = append(rest, name)
+		}
+	}
+	slices.Sort(rest)
+	for _, name := range rest {
+		visit(name)
+	}
+
+	// Hosts that only have variables belong to no group
+	var ungrouped []string
+	for h := range hostVars {
+		if _, ok := inv.hostVars[h]; !ok {
+			ungrouped = append(ungrouped, h)
+		}
+	}
+	slices.Sort(ungrouped)
+	for _, h := range ungrouped {
+		inv.addHost(inventoryUngroupedGroup, h, hostVars[h], 0)
+	}
+
+	return inv, nil
+}
+
+// jsonVars returns the variables in the decoded JSON object 'v'. Strings and
+// numbers are kept as they are, while everything else is kept as JSON.
+func jsonVars(v any) map[string]string {
+	vars := make(map[string]string)
+	obj, _ := v.(map[string]any)
+	for k, value := range obj {
+		vars[k] = jsonString(value)
+	}
+	return vars
+}
+
+// jsonString returns the decoded JSON value 'v' as a string.
+func jsonString(v any) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case json.Number:
+		return s.String()
+	}
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+// jsonStrings returns the decoded JSON array 'v' as a slice of strings.
+func jsonStrings(v any) []string {
+	arr, _ := v.([]any)
+	var s []string
+	for _, a := range arr {
+		s = append(s, jsonString(a))
+	}
+	return s
+}
+
+func init() {
+	registerHostSource(inventorySource, newInventoryHostSource)
+	registerHostSource(commandSource, newCommandHostSource)
+}
+
+// An inventoryHostSource is a 'HostSource' for the hosts of an inventory file
+// in either the INI or the YAML format.
+type inventoryHostSource struct {
+	watchedFiles
+	name         string
+	path         string
+	format       string
+	switchFilter bool
+}
+
+// newInventoryHostSource returns an 'inventoryHostSource' for the inventory
+// at path 'value' in the format given with '-inventoryformat', or the one
+// based on its extension.
+func newInventoryHostSource(name, value string, opts sourceOptions) (HostSource, error) {
+	if value == "" {
+		return nil, errors.New("missing path to inventory given after ':'")
+	}
+	format, err := inventoryFormat(value, opts.InventoryFormat)
+	if err != nil {
+		return nil, err
+	}
+	s := &inventoryHostSource{name: name, path: expandTilde(value), format: format, switchFilter: opts.SwitchFilter}
+	s.setFiles(s.path)
+	return s, nil
+}
+
+func (s *inventoryHostSource) Name() string { return s.name }
+
+// Load returns the hosts of the inventory.
+func (s *inventoryHostSource) Load(ctx context.Context) ([]list.Item, error) {
+	if s.format == "yaml" {
+		return yamlHosts(s.path, s.switchFilter)
+	}
+	return iniHosts(s.path, s.switchFilter)
+}
+
+// A commandHostSource is a 'HostSource' for the hosts printed as JSON by a
+// command. As there is nothing to watch, it's only ever loaded once.
+type commandHostSource struct {
+	name         string
+	command      string
+	switchFilter bool
+}
+
+// newCommandHostSource returns a 'commandHostSource' running the command
+// given as 'value'.
+func newCommandHostSource(name, value string, opts sourceOptions) (HostSource, error) {
+	if value == "" {
+		return nil, errors.New("missing command given after ':'")
+	}
+	return &commandHostSource{name: name, command: value, switchFilter: opts.SwitchFilter}, nil
+}
+
+func (s *commandHostSource) Name() string { return s.name }
+
+// Load runs the command and returns the hosts it printed.
+func (s *commandHostSource) Load(ctx context.Context) ([]list.Item, error) {
+	return commandHosts(ctx, s.command, s.switchFilter)
+}
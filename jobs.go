@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+)
+
+// Kinds of jobs run in the background.
+const (
+	pingJob    = "ping"
+	probeJob   = "probe"
+	connectJob = "connect"
+)
+
+var (
+	jobsPanelStyle    = livePanelStyle.BorderForeground(nordAuroraGreen)
+	jobsTitleStyle    = lipgloss.NewStyle().Foreground(nordAuroraGreen)
+	jobsSelectedStyle = lipgloss.NewStyle().Foreground(nordAuroraGreen)
+)
+
+// A job is a command running in the background against a single host.
+//
+// Index is where the host was in the unfiltered list when the job was
+// started, which is where its result goes unless the list changed since.
+// Args are what SSH was given, for jobs that run it.
+type job struct {
+	ID          int
+	Kind        string
+	Item        Item
+	Index       int
+	Description string
+	Args        []string
+	Started     time.Time
+	cancel      context.CancelFunc
+}
+
+// A jobManager keeps track of every job that is running. Each job gets an
+// ID that its result messages carry, so results are never mistaken for
+// those of another job.
+//
+// It's shared between copies of the model, so it's always used through a
+// pointer.
+type jobManager struct {
+	next int
+	jobs []*job
+}
+
+// start adds a job of 'kind' for 'i' and returns it along with the context
+// that is canceled when the job is.
+func (j *jobManager) start(kind string, i Item, index int, description string) (*job, context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	j.next++
+	jb := &job{ID: j.next, Kind: kind, Item: i, Index: index, Description: description, Started: time.Now(), cancel: cancel}
+	j.jobs = append(j.jobs, jb)
+	return jb, ctx
+}
+
+// finish removes the job with 'id' and returns it, or false when there's no
+// such job because it was canceled.
+func (j *jobManager) finish(id int) (*job, bool) {
+	for n, jb := range j.jobs {
+		if jb.ID == id {
+			j.jobs = append(j.jobs[:n], j.jobs[n+1:]...)
+			jb.cancel()
+			return jb, true
+		}
+	}
+	return nil, false
+}
+
+// cancel cancels the job with 'id', killing its command, and reports
+// whether there was such a job.
+func (j *jobManager) cancel(id int) bool {
+	_, ok := j.finish(id)
+	return ok
+}
+
+// byKind returns the first job of 'kind' that is running, if any.
+func (j *jobManager) byKind(kind string) (*job, bool) {
+	for _, jb := range j.jobs {
+		if jb.Kind == kind {
+			return jb, true
+		}
+	}
+	return nil, false
+}
+
+// cancelAll cancels every job.
+func (j *jobManager) cancelAll() {
+	for _, jb := range j.jobs {
+		jb.cancel()
+	}
+	j.jobs = nil
+}
+
+// status returns the line shown in the status bar while jobs are running.
+func (j *jobManager) status() string {
+	switch len(j.jobs) {
+	case 0:
+		return ""
+	case 1:
+		return j.jobs[0].Description
+	}
+	return fmt.Sprintf("%d jobs running", len(j.jobs))
+}
+
+// view returns the panel listing every job with the one at 'cursor'
+// highlighted.
+func (j *jobManager) view(cursor int) string {
+	lines := []string{jobsTitleStyle.Render(fmt.Sprintf("Jobs (%d running)", len(j.jobs))), ""}
+	if len(j.jobs) == 0 {
+		lines = append(lines, unknownStyle.Render("Nothing is running"))
+	}
+	for n, jb := range j.jobs {
+		line := fmt.Sprintf("  #%d %-8s %s (%v)", jb.ID, jb.Kind, jb.Description, time.Since(jb.Started).Round(time.Second))
+		if n == cursor {
+			line = jobsSelectedStyle.Render(fmt.Sprintf("> %s", line[2:]))
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "", versionStyle("↑/↓ choose • x cancel job • esc back"))
+	return jobsPanelStyle.Render(strings.Join(lines, "\n"))
+}
+
+// A pingJobMsg carries the output of 'ping' run by the job with the
+// given ID, or what it wrote to its standard error.
+type pingJobMsg struct {
+	id int
+	commandResult
+}
+
+// A probeJobMsg carries the result of probing a host's SSH port by the
+// job with the given ID.
+type probeJobMsg struct {
+	id     int
+	result probeResult
+}
+
+// A connectJobMsg carries the output of the SSH connection made by the
+// job with the given ID, or what it wrote to its standard error, along with
+// every phase of connecting that was done. The error is set when connecting
+// took too long.
+type connectJobMsg struct {
+	id int
+	commandResult
+	phases []connectPhase
+	err    error
+}
+
+// A commandResult is the lines a command wrote to its standard output, or
+// what it wrote to its standard error along with its exit code.
+type commandResult struct {
+	output   []string
+	stderr   string
+	exitCode int
+}
+
+// runCommand runs 'name' command with 'arg...', which is killed when 'ctx'
+// is done, and returns the lines of its standard output. Should anything
+// be written to its standard error that is returned instead, along with
+// the exit code once the command has finished.
+//
+// 'wait' is required for commands where the entire output is required and
+// the command must waited upon to finish.
+func runCommand(ctx context.Context, name string, wait bool, arg ...string) commandResult {
+	c := exec.CommandContext(ctx, name, arg...)
+	stdout, _ := c.StdoutPipe()
+	stderr, _ := c.StderrPipe()
+
+	if err := c.Start(); err != nil {
+		return commandResult{stderr: err.Error(), exitCode: -1}
+	}
+
+	slurp, _ := io.ReadAll(stderr)
+	if len(slurp) > 0 {
+		// A command complaining is about to exit, if it hasn't already
+		c.Wait()
+		return commandResult{stderr: string(slurp), exitCode: c.ProcessState.ExitCode()}
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(bufio.ScanLines)
+
+	var out []string
+	out = append(out, scanner.Text())
+	for scanner.Scan() {
+		out = append(out, scanner.Text())
+	}
+	if wait {
+		c.Wait()
+	}
+	return commandResult{output: out}
+}
+
+// pingCommand returns a command that pings 'host' in the background as
+// the job with 'id'.
+func pingCommand(ctx context.Context, id int, host string, pingOpts []string) tea.Cmd {
+	return func() tea.Msg {
+		return pingJobMsg{id: id, commandResult: runCommand(ctx, "ping", true, append([]string{host}, pingOpts...)...)}
+	}
+}
+
+// probeCommand returns a command that probes the SSH port of 'i' in the
+// background as the job with 'id'.
+func probeCommand(ctx context.Context, id int, i Item, sshOpts []string, timeout time.Duration) tea.Cmd {
+	return func() tea.Msg {
+		return probeJobMsg{id: id, result: probeItem(ctx, i, sshOpts, timeout)}
+	}
+}
+
+// connectCommand returns a command that connects with SSH using 'args' in
+// the background as the job with 'id', which is killed when it takes longer
+// than 'timeout' unless that is zero. Each phase of connecting is reported
+// as it's done.
+func connectCommand(ctx context.Context, id int, args []string, timeout time.Duration) tea.Cmd {
+	phases := make(chan connectPhaseMsg)
+	connect := func() tea.Msg {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		result, done := runConnect(ctx, id, args, phases)
+		// Whatever was read from a killed process isn't a connection
+		if err := ctx.Err(); err != nil {
+			return connectJobMsg{id: id, err: err}
+		}
+		return connectJobMsg{id: id, commandResult: result, phases: done}
+	}
+	return tea.Batch(connect, waitForConnectPhase(phases))
+}
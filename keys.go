@@ -3,13 +3,19 @@ package main
 import "charm.land/bubbles/v2/key"
 
 type customKeyMap struct {
-	Input   key.Binding
-	Connect key.Binding
-	Cancel  key.Binding
-	Sort    key.Binding
-	Delete  key.Binding
-	Ping    key.Binding
-	Copy    key.Binding
+	Input      key.Binding
+	Connect    key.Binding
+	Cancel     key.Binding
+	Sort       key.Binding
+	Delete     key.Binding
+	Ping       key.Binding
+	Live       key.Binding
+	Copy       key.Binding
+	Sweep      key.Binding
+	Jobs       key.Binding
+	Masters    key.Binding
+	TmuxWindow key.Binding
+	TmuxSplit  key.Binding
 }
 
 var customKeys = customKeyMap{
@@ -37,8 +43,32 @@ var customKeys = customKeyMap{
 		key.WithKeys("p"),
 		key.WithHelp("p", "ping host"),
 	),
+	Live: key.NewBinding(
+		key.WithKeys("P"),
+		key.WithHelp("P", "live ping"),
+	),
 	Copy: key.NewBinding(
 		key.WithKeys("c"),
 		key.WithHelp("c", "copy 'HostName'"),
 	),
+	Sweep: key.NewBinding(
+		key.WithKeys("s"),
+		key.WithHelp("s", "sweep hosts"),
+	),
+	Jobs: key.NewBinding(
+		key.WithKeys("J"),
+		key.WithHelp("J", "jobs"),
+	),
+	Masters: key.NewBinding(
+		key.WithKeys("m"),
+		key.WithHelp("m", "control masters"),
+	),
+	TmuxWindow: key.NewBinding(
+		key.WithKeys("t"),
+		key.WithHelp("t", "tmux window"),
+	),
+	TmuxSplit: key.NewBinding(
+		key.WithKeys("T"),
+		key.WithHelp("T", "tmux split"),
+	),
 }
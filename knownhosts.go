@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	"charm.land/bubbles/v2/list"
+)
+
+// knownHostsHosts returns a slice of 'list.Item' containing hosts from an
+// OpenSSH known_hosts file as type 'Item' and 'error'.
+func knownHostsHosts(filePath string) ([]list.Item, error) {
+	filePath = expandTilde(filePath)
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file '%s': %w", filePath, err)
+	}
+	items := findKnownHosts(content)
+	setOriginFile(items, filePath)
+	return items, nil
+}
+
+// findKnownHosts returns a slice of 'list.Item' from each host found in the
+// given 'content' slice of bytes in the known_hosts format described in
+// sshd(8), with each 'Item' carrying the key types known for the host.
+//
+// Hosts given as '[host]:port' keep their port. Hashed hosts can't be turned
+// back into names, and neither patterns nor lines marked as
+// '@cert-authority' or '@revoked' name individual hosts, so they are all
+// left out.
+func findKnownHosts(content []byte) []list.Item {
+	var (
+		items []list.Item
+		index = make(map[string]int)
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+			continue
+		}
+
+		for _, pattern := range strings.Split(fields[0], ",") {
+			if strings.HasPrefix(pattern, "|") || strings.ContainsAny(pattern, "*?!") {
+				continue
+			}
+			host, port := splitKnownHost(pattern)
+
+			key := net.JoinHostPort(host, port)
+			if n, ok := index[key]; ok {
+				i := items[n].(Item)
+				if !slices.Contains(strings.Split(i.KeyType, ", "), fields[1]) {
+					i.KeyType = fmt.Sprintf("%s, %s", i.KeyType, fields[1])
+				}
+				items[n] = i
+				continue
+			}
+
+			index[key] = len(items)
+			items = append(items, Item{Host: host, Hostname: host, Port: port, KeyType: fields[1], Origins: []itemOrigin{{Source: knownHostsSource, Line: n}}})
+		}
+	}
+
+	return items
+}
+
+// splitKnownHost splits a known_hosts host of the form '[host]:port' into its
+// host and port. Hosts in any other form use the default port, for which an
+// empty port is returned.
+func splitKnownHost(pattern string) (string, string) {
+	if !strings.HasPrefix(pattern, "[") {
+		return pattern, ""
+	}
+	host, port, err := net.SplitHostPort(pattern)
+	if err != nil {
+		return pattern, ""
+	}
+	if port == "22" {
+		port = ""
+	}
+	return host, port
+}
+
+func init() {
+	registerHostSource(knownHostsSource, newKnownHostsHostSource)
+}
+
+// A knownHostsHostSource is a 'HostSource' for the hosts of a known_hosts
+// file.
+type knownHostsHostSource struct {
+	watchedFiles
+	name string
+	path string
+}
+
+// newKnownHostsHostSource returns a 'knownHostsHostSource' for the file at
+// path 'value', or at the path given with '-knownhostspath' when 'value' is
+// empty.
+func newKnownHostsHostSource(name, value string, opts sourceOptions) (HostSource, error) {
+	s := &knownHostsHostSource{name: name, path: expandTilde(cmp.Or(value, opts.KnownHostsPath))}
+	s.setFiles(s.path)
+	return s, nil
+}
+
+func (s *knownHostsHostSource) Name() string { return s.name }
+
+// Load returns the hosts of the known_hosts file.
+func (s *knownHostsHostSource) Load(ctx context.Context) ([]list.Item, error) {
+	return knownHostsHosts(s.path)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+)
+
+// execLauncher is the name of replacing the program with SSH, which is what
+// happens without a launcher.
+const execLauncher = "exec"
+
+// launchWait is how long a launcher is given to fail before the session is
+// taken to be open, as some keep running for as long as the session does.
+const launchWait = 2 * time.Second
+
+// A Launcher opens sessions with SSH somewhere other than the terminal the
+// program runs in, like a new window or tab, which leaves the list open.
+//
+// New launchers are added by implementing it in a separate file and
+// registering it with 'registerLauncher' from an 'init' function.
+type Launcher interface {
+	// Args returns the command and its arguments for opening a session
+	// with 'i', where SSH is given 'sshArgs'.
+	Args(i Item, sshArgs []string) []string
+	// Available reports whether sessions can be opened from where the
+	// program runs, as otherwise it's replaced with SSH as usual.
+	Available() bool
+	// String returns where sessions are opened, as shown in the status
+	// bar.
+	String() string
+}
+
+// launchers holds every launcher by its name.
+var launchers = make(map[string]Launcher)
+
+// registerLauncher makes 'l' available as 'name' through the '-launcher'
+// flag. Registering the same name twice is a programming error.
+func registerLauncher(name string, l Launcher) {
+	if _, ok := launchers[name]; ok || name == execLauncher {
+		panic(fmt.Sprintf("launcher '%s' registered twice", name))
+	}
+	launchers[name] = l
+}
+
+// launcherNames returns the name of every launcher, sorted.
+func launcherNames() []string {
+	names := []string{execLauncher}
+	for name := range launchers {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// newLauncher returns the launcher called 'name', or one running 'name' as
+// a command template when it has any placeholders. No launcher is returned
+// for replacing the program with SSH.
+func newLauncher(name string) (Launcher, error) {
+	if name == "" || name == execLauncher {
+		return nil, nil
+	}
+	if l, ok := launchers[name]; ok {
+		return l, nil
+	}
+	if strings.Contains(name, "{host}") || strings.Contains(name, "{name}") {
+		return newTemplateLauncher(name)
+	}
+	return nil, fmt.Errorf("unknown launcher '%s', must be one of '%s' or a command with '{host}'", name, strings.Join(launcherNames(), "', '"))
+}
+
+// A templateLauncher runs a command given by the user, such as
+// 'alacritty -e ssh {host}'. The argument '{host}' is replaced with the
+// arguments for SSH, which reuse the control master, and '{name}' anywhere
+// with the host's name. A '{host}' within an argument, as in
+// 'sh -c "ssh {host}"', is replaced with the arguments quoted for a shell.
+type templateLauncher struct {
+	template string
+	words    []string
+}
+
+// newTemplateLauncher returns a launcher running 'template', which is
+// split into arguments in the same way as SSH configurations are.
+func newTemplateLauncher(template string) (Launcher, error) {
+	words, err := splitSshConfigArgs(template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid launcher '%s': %w", template, err)
+	}
+	if len(words) == 0 || words[0] == "{host}" {
+		return nil, fmt.Errorf("invalid launcher '%s': no command to run", template)
+	}
+	return templateLauncher{template: template, words: words}, nil
+}
+
+// Args returns the template with its placeholders replaced.
+func (t templateLauncher) Args(i Item, sshArgs []string) []string {
+	var args []string
+	for _, w := range t.words {
+		if w == "{host}" {
+			args = append(args, sshArgs...)
+			continue
+		}
+		w = strings.ReplaceAll(w, "{host}", shellJoin(sshArgs))
+		args = append(args, strings.ReplaceAll(w, "{name}", i.Host))
+	}
+	return args
+}
+
+// shellSafePattern matches arguments that a shell takes as they are.
+var shellSafePattern = regexp.MustCompile(`^[A-Za-z0-9@%+=:,./_-]+$`)
+
+// shellJoin returns 'args' as a single command line for a shell, with the
+// arguments that need it in single quotes.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for n, a := range args {
+		if shellSafePattern.MatchString(a) {
+			quoted[n] = a
+			continue
+		}
+		quoted[n] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Available reports that commands can be run from anywhere.
+func (t templateLauncher) Available() bool { return true }
+
+// String returns the command being run.
+func (t templateLauncher) String() string { return fmt.Sprintf("'%s'", t.words[0]) }
+
+// A launchedMsg indicates that a session with 'item' was opened in 'where',
+// or the error that prevented it.
+type launchedMsg struct {
+	item  Item
+	where string
+	err   error
+}
+
+// launchCommand returns a command that opens a session with 'i' through
+// 'l', where SSH is given 'sshArgs'. Launchers that are still running after
+// a short while are taken to have opened the session and are left to run.
+func launchCommand(i Item, l Launcher, sshArgs []string) tea.Cmd {
+	args := l.Args(i, sshArgs)
+	return func() tea.Msg {
+		var out bytes.Buffer
+		c := exec.Command(args[0], args[1:]...)
+		c.Stdout, c.Stderr = &out, &out
+		if err := c.Start(); err != nil {
+			return launchedMsg{item: i, where: l.String(), err: err}
+		}
+		done := make(chan error, 1)
+		go func() { done <- c.Wait() }()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				err = fmt.Errorf("%w: %s", err, strings.TrimSpace(out.String()))
+			}
+			return launchedMsg{item: i, where: l.String(), err: err}
+		case <-time.After(launchWait):
+			return launchedMsg{item: i, where: l.String()}
+		}
+	}
+}
+
+// sshCommand returns 'sshArgs' preceded by the name of SSH, for launchers
+// that are given the command to run.
+func sshCommand(sshArgs []string) []string {
+	return append([]string{sshExecutableName}, slices.Clone(sshArgs)...)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+)
+
+// defaultLiveInterval is how often a host is probed in live ping mode.
+const defaultLiveInterval = time.Second
+
+// How much of the history of a live ping is kept for showing.
+const (
+	maxLiveSamples     = 60
+	maxLiveTransitions = 5
+)
+
+var (
+	livePanelStyle = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(nordAuroraYellow).
+			Padding(0, 1)
+	liveTitleStyle = lipgloss.NewStyle().Foreground(nordAuroraYellow)
+)
+
+// A liveResultMsg carries the status of the host in live ping mode found by
+// a single probe.
+type liveResultMsg struct {
+	status  hostStatus
+	results <-chan liveResultMsg
+}
+
+// A liveTransition is when a host in live ping mode went up or down.
+type liveTransition struct {
+	At    time.Time
+	State reachability
+}
+
+// A livePing keeps probing a single host every interval until it's stopped,
+// keeping statistics on the replies and a history of the most recent ones.
+type livePing struct {
+	item     Item
+	interval time.Duration
+	timeout  time.Duration
+	probe    string
+	sshOpts  []string
+
+	sent        int
+	received    int
+	total       time.Duration
+	min         time.Duration
+	max         time.Duration
+	history     []hostStatus
+	transitions []liveTransition
+
+	cancel  context.CancelFunc
+	done    chan struct{}
+	results <-chan liveResultMsg
+}
+
+// start starts probing the host in the background, returning a command that
+// waits for the first result.
+func (l *livePing) start() tea.Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
+	results := make(chan liveResultMsg)
+	l.cancel, l.done, l.results = cancel, make(chan struct{}), results
+
+	go func() {
+		defer close(l.done)
+		defer close(results)
+		ticker := time.NewTicker(l.interval)
+		defer ticker.Stop()
+		for {
+			status := probeStatus(ctx, l.item, l.probe, l.sshOpts, l.timeout)
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case results <- liveResultMsg{status: status, results: results}:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return waitForLiveResult(results)
+}
+
+// stop stops probing the host and waits until any probe still running was
+// killed, so nothing is left behind when leaving live ping mode.
+func (l *livePing) stop() {
+	if l.cancel == nil {
+		return
+	}
+	l.cancel()
+	<-l.done
+	l.cancel = nil
+}
+
+// waitForLiveResult returns a command that waits for the next result of a
+// live ping on 'results'.
+func waitForLiveResult(results <-chan liveResultMsg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-results
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// record adds the outcome of a single probe to the statistics and history.
+func (l *livePing) record(status hostStatus) {
+	l.sent++
+	if status.State == reachUp {
+		if l.received == 0 || status.Latency < l.min {
+			l.min = status.Latency
+		}
+		l.max = max(l.max, status.Latency)
+		l.received++
+		l.total += status.Latency
+	}
+
+	if len(l.history) == 0 || l.history[len(l.history)-1].State != status.State {
+		l.transitions = append(l.transitions, liveTransition{At: status.Checked, State: status.State})
+		// One more than is shown is kept for how long the first shown lasted
+		if len(l.transitions) > maxLiveTransitions+1 {
+			l.transitions = l.transitions[1:]
+		}
+	}
+	l.history = append(l.history, status)
+	if len(l.history) > maxLiveSamples {
+		l.history = l.history[len(l.history)-maxLiveSamples:]
+	}
+}
+
+// loss returns the percentage of probes that went unanswered.
+func (l *livePing) loss() float64 {
+	if l.sent == 0 {
+		return 0
+	}
+	return float64(l.sent-l.received) / float64(l.sent) * 100
+}
+
+// String returns the statistics in the form shown in the status bar after
+// leaving live ping mode.
+func (l *livePing) String() string {
+	s := fmt.Sprintf("%d/%d received, %.1f%% loss", l.received, l.sent, l.loss())
+	if l.received == 0 {
+		return s
+	}
+	avg := l.total / time.Duration(l.received)
+	return fmt.Sprintf("%s, rtt min/avg/max %v/%v/%v", s, roundRtt(l.min), roundRtt(avg), roundRtt(l.max))
+}
+
+// graph returns the history drawn as a sparkline of the round-trip times of
+// replies, where unanswered probes are drawn as gaps.
+func (l *livePing) graph() string {
+	var up []time.Duration
+	for _, s := range l.history {
+		if s.State == reachUp {
+			up = append(up, s.Latency)
+		}
+	}
+	var low, high time.Duration
+	if len(up) > 0 {
+		low, high = slices.Min(up), slices.Max(up)
+	}
+
+	var b strings.Builder
+	for _, s := range l.history {
+		if s.State == reachUp {
+			b.WriteString(upStyle.Render(string(sparklineBlock(s.Latency, low, high))))
+		} else {
+			b.WriteString(downStyle.Render("·"))
+		}
+	}
+	return b.String()
+}
+
+// view returns the panel shown while in live ping mode.
+func (l *livePing) view() string {
+	lines := []string{liveTitleStyle.Render(fmt.Sprintf("Live ping %q (%s) every %v", l.item.Host, l.item.probeAddress(), l.interval))}
+	if len(l.history) == 0 {
+		lines = append(lines, "", unknownStyle.Render("Waiting for the first probe..."))
+	} else {
+		lines = append(lines, "", fmt.Sprintf("%s  %s", l.history[len(l.history)-1].marker(), l), "", l.graph())
+	}
+
+	if len(l.transitions) > 0 {
+		lines = append(lines, "")
+	}
+	for n := max(len(l.transitions)-maxLiveTransitions, 0); n < len(l.transitions); n++ {
+		t := l.transitions[n]
+		state := upStyle.Render("up")
+		if t.State == reachDown {
+			state = downStyle.Render("down")
+		}
+		line := fmt.Sprintf("%s  %s", t.At.Format(time.TimeOnly), state)
+		if n > 0 {
+			line = fmt.Sprintf("%s after %v", line, t.At.Sub(l.transitions[n-1].At).Round(time.Second))
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, "", versionStyle("esc stop live ping"))
+	return livePanelStyle.Render(strings.Join(lines, "\n"))
+}
@@ -1,21 +1,22 @@
 // Package wishlistlite is a pared down version of Charm's Wishlist.
 //
 // It leverages SSH-related executables already present on the local system to
-// simplify everything and relies on just regular expressions to parse an SSH
-// configuration.
+// simplify everything and parses an SSH configuration on its own following the
+// rules laid out in ssh_config(5).
 //
 // Its aim was to provide a more hands-on way to learn about Go and isn't to be
 // taken seriously.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
-	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"charm.land/bubbles/v2/list"
 	tea "charm.land/bubbletea/v2"
@@ -28,36 +29,105 @@ func newPingOpts(count int) []string {
 	return []string{"-c", fmt.Sprint(count)}
 }
 
-func getSshControlPath() string {
-	if runtime.GOOS == "darwin" {
-		return "/tmp"
-	}
-	return "/dev/shm"
-}
-
 // Paths, 'ping' and SSH control options used by package.
 var (
+	defaultSshDir           = expandTilde("~/.ssh")
 	defaultSshConfigPath    = expandTilde("~/.ssh/config")
+	defaultKnownHostsPath   = expandTilde("~/.ssh/known_hosts")
 	defaultRecentlyUsedPath = expandTilde("~/.ssh/recent.json")
-	sshControlPath          = fmt.Sprintf("%s/control:%s", getSshControlPath(), "%h:%p:%r")
-	sshControlChildOpts     = []string{"-S", sshControlPath}
-	sshControlParentOpts    = []string{"-T", "-o", "ControlMaster=auto", "-o", "ControlPersist=5s", "-o", fmt.Sprintf("ControlPath=%s", sshControlPath)}
+	sshControl              = controlOptions{Dir: defaultControlDir(), Persist: defaultControlPersist}
 	defaultPingCount        = 4
+	inventoryCommandTimeout = 30 * time.Second
 	pingOpts                = newPingOpts(defaultPingCount)
 )
 
 func main() {
 	sshConfigPath := flag.String("sshconfigpath", defaultSshConfigPath, "Path to SSH configuration file")
 	recentlyUsedPath := flag.String("recentlyusedpath", defaultRecentlyUsedPath, "Path to recent SSH connections file")
-	iniFilePath := flag.String("inifilepath", "", "Path to INI file path (e.g. Ansible inventory file) in lieu of SSH configuration file")
+	iniFilePath := flag.String("inifilepath", "", "Path to INI or YAML file path (e.g. Ansible inventory file) in lieu of SSH configuration file")
+	invFormat := flag.String("inventoryformat", "", "Format of the file given with '-inifilepath': 'ini' or 'yaml' (default based on file extension)")
+	invCommand := flag.String("inventorycommand", "", "Command printing hosts as JSON (e.g. 'ansible-inventory -i hosts --list') in lieu of SSH configuration file")
+	knownHosts := flag.Bool("knownhosts", false, "Whether or not to also list hosts from a known_hosts file")
+	knownHostsPath := flag.String("knownhostspath", defaultKnownHostsPath, "Path to known_hosts file used with '-knownhosts'")
+	var specs sourceFlag
+	flag.Var(&specs, "source", "Source of hosts as 'kind' or 'kind:value' where kind is 'ssh_config', 'inventory', 'command', 'known_hosts', or any other registered source. May be repeated to combine sources")
+	precedence := flag.String("precedence", "", "Comma-separated sources whose hosts are kept when merging duplicates (default order of '-source')")
 	switchFilter := flag.Bool("switchfilter", false, "Whether or not to switch filter value from host to hostname")
 	pingCount := flag.Int("pingcount", defaultPingCount, "Number of times a host should be pinged")
+	probe := flag.String("probe", icmpProbe, "How hosts are probed: 'icmp' runs 'ping' and 'tcp' connects to the SSH port, going through any ProxyJump")
+	probeTimeout := flag.Duration("probetimeout", defaultProbeTimeout, "How long a probe may take")
+	liveInterval := flag.Duration("liveinterval", defaultLiveInterval, "How often a host is probed in live ping mode")
+	sweep := flag.Bool("sweep", false, "Whether or not to probe every host in the background on start")
+	sweepWorkers := flag.Int("sweepworkers", defaultSweepWorkers, "Number of hosts probed at the same time when sweeping")
+	sweepRate := flag.Int("sweeprate", defaultSweepRate, "Maximum number of probes started per second when sweeping")
+	sweepTTL := flag.Duration("sweepttl", defaultSweepTTL, "How long results of sweeps are shown on later launches")
+	connectTimeout := flag.Duration("connecttimeout", defaultConnectTimeout, "How long connecting may take before it's canceled, or 0 to wait indefinitely")
+	controlDir := flag.String("controldir", sshControl.Dir, "Directory control sockets are kept in, which must only be writable by the user")
+	controlPersist := flag.String("controlpersist", defaultControlPersist, "How long control masters stay around after their last connection, unless a host's 'ControlPersist' says otherwise")
+	interactiveHosts := flag.String("interactivehosts", "", "Comma-separated patterns of hosts that prompt for a password or a code when connecting, which is otherwise detected")
+	launcherName := flag.String("launcher", execLauncher, fmt.Sprintf("Where pressing Enter opens sessions: one of '%s', or a command like 'alacritty -e ssh {host}'. Launchers that don't work from where the program runs replace it with SSH", strings.Join(launcherNames(), "', '")))
+	tmux := flag.String("tmux", "", "Where in tmux pressing Enter opens sessions when running inside tmux: 'window' or 'split'. Same as '-launcher tmux' and '-launcher tmux-split'")
+	loop := flag.Bool("loop", false, "Whether or not to come back to the list of hosts after each session instead of replacing the program with SSH")
 	sshOpts := flag.String("sshoptions", "", "Additional options passed to SSH. Must be contained in quotes")
+	resolve := flag.Bool("resolve", false, "Whether or not to resolve each host's settings through 'ssh -G'")
+	watch := flag.Bool("watch", false, "Whether or not to reload hosts when the files they come from change")
+	compare := flag.Bool("compare", false, "Report hosts where parsed settings differ from those of 'ssh -G' and exit")
+	defaultConfigPath, _ := configPath()
+	config := flag.String("config", defaultConfigPath, "Path to configuration file with a flag's name and its default value on each line, e.g. 'launcher = kitty'")
 	flag.Parse()
 
+	// Flags given on the command line take precedence over those
+	// in the configuration file
+	var explicitConfig bool
+	flag.Visit(func(f *flag.Flag) { explicitConfig = explicitConfig || f.Name == "config" })
+	if *config != "" {
+		if err := readConfig(flag.CommandLine, *config, explicitConfig); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
 	if *pingCount != defaultPingCount {
 		pingOpts = newPingOpts(*pingCount)
 	}
+	if *probe != icmpProbe && *probe != tcpProbe {
+		fmt.Printf("unknown probe '%s'\n", *probe)
+		os.Exit(1)
+	}
+	if *liveInterval <= 0 {
+		fmt.Println("live ping interval must be positive")
+		os.Exit(1)
+	}
+	if *tmux != "" && *tmux != tmuxWindow && *tmux != tmuxSplit {
+		fmt.Printf("unknown tmux location '%s'\n", *tmux)
+		os.Exit(1)
+	}
+	if *tmux == tmuxWindow && *launcherName == execLauncher {
+		*launcherName = "tmux"
+	} else if *tmux == tmuxSplit && *launcherName == execLauncher {
+		*launcherName = "tmux-split"
+	}
+	launcher, err := newLauncher(*launcherName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *connectTimeout < 0 {
+		fmt.Println("connect timeout must not be negative")
+		os.Exit(1)
+	}
+
+	if v := strings.ToLower(*controlPersist); v == "" || v == "no" || v == "false" {
+		fmt.Println("control persist must not be empty or 'no' as sessions reuse the control master")
+		os.Exit(1)
+	}
+	sshControl = controlOptions{Dir: *controlDir, Persist: *controlPersist}
+	if err := prepareControlDir(sshControl.Dir); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// Runs that crashed may have left sockets behind
+	cleanStaleSockets(sshControl.Dir)
 
 	sshExecutablePath, err := exec.LookPath(sshExecutableName)
 	// Using 'panic()' as it's supposedly acceptable during initialization phases:
@@ -66,19 +136,41 @@ func main() {
 		panic(err)
 	}
 
-	var items []list.Item
-	if *iniFilePath != "" {
-		items, err = iniHosts(*iniFilePath, *switchFilter)
-		if err != nil {
-			fmt.Println("failed to read input file: %w", err)
-			os.Exit(1)
+	// Without any sources given the older flags choose a single one
+	if len(specs) == 0 {
+		switch {
+		case *invCommand != "":
+			specs = append(specs, sourceSpec{Kind: commandSource, Value: *invCommand})
+		case *iniFilePath != "":
+			specs = append(specs, sourceSpec{Kind: inventorySource, Value: *iniFilePath})
+		default:
+			specs = append(specs, sourceSpec{Kind: sshConfigSource})
 		}
-	} else {
-		items, err = sshConfigHosts(*sshConfigPath)
+		if *knownHosts {
+			specs = append(specs, sourceSpec{Kind: knownHostsSource})
+		}
+	}
+	labelSources(specs)
+	if err := sortByPrecedence(specs, *precedence); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	opts := sourceOptions{
+		SshConfigPath:   *sshConfigPath,
+		KnownHostsPath:  *knownHostsPath,
+		IncludeDir:      defaultSshDir,
+		InventoryFormat: *invFormat,
+		SwitchFilter:    *switchFilter,
+	}
+	var sources []HostSource
+	for _, spec := range specs {
+		source, err := spec.open(opts)
 		if err != nil {
-			fmt.Println("failed to read SSH configuration: %w", err)
+			fmt.Println(err)
 			os.Exit(1)
 		}
+		sources = append(sources, source)
 	}
 
 	sortedItems, err := itemsFromJson(*recentlyUsedPath)
@@ -89,26 +181,151 @@ func main() {
 	if *sshOpts == "" {
 		sshopts = []string{}
 	}
-	p := tea.NewProgram(newModel(items, sortedItems, *recentlyUsedPath, pingOpts, sshopts))
+
+	if *compare {
+		os.Exit(compareSources(sources, sshopts))
+	}
+
+	items, errs := loadHosts(context.Background(), sources, *resolve, sshopts)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(items) == 0 && len(errs) > 0 {
+		os.Exit(1)
+	}
+
+	// Hosts swept recently enough show their status right away
+	cachePath, err := statusCachePath()
+	cache, cacheErr := loadStatusCache(cachePath)
+	if err != nil || cacheErr != nil {
+		cache = make(statusCache)
+	}
+	items = cache.apply(items, *sweepTTL)
+	if *sweep {
+		items = markUnknown(items)
+	}
+
+	initial := newModel(items, sortedItems, *recentlyUsedPath, pingOpts, sshopts)
+	initial.probe, initial.probeTimeout, initial.liveInterval = *probe, *probeTimeout, *liveInterval
+	initial.sweeper = &sweeper{workers: *sweepWorkers, rate: *sweepRate, timeout: *probeTimeout, probe: *probe, sshOpts: sshopts}
+	initial.sweepOnStart, initial.statusCache, initial.statusTTL = *sweep, cache, *sweepTTL
+	initial.connectTimeout, initial.interactiveHosts = *connectTimeout, *interactiveHosts
+	initial.loop, initial.launcher = *loop, launcher
+	// Sessions can only be opened in tmux from inside it
+	customKeys.TmuxWindow.SetEnabled(insideTmux())
+	customKeys.TmuxSplit.SetEnabled(insideTmux())
+	if len(errs) > 0 {
+		// Hosts from whatever could be read are still usable
+		initial.connection.state = "Warning"
+		initial.connection.output = sourceWarning(errs)
+	}
+	p := tea.NewProgram(initial)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if *watch {
+		watchSources(ctx, sources, func() {
+			items, errs := loadHosts(ctx, sources, *resolve, sshopts)
+			p.Send(hostsLoadedMsg{items: items, errs: errs})
+		})
+	}
 
 	m, err := p.Run()
+	cancel()
+	if m, ok := m.(model); ok && cachePath != "" && len(m.statusCache) > 0 {
+		m.sweeper.stop()
+		if err := m.statusCache.save(cachePath); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to save host statuses:", err)
+		}
+	}
 	if err != nil {
 		fmt.Println("failed to execute: %w", err)
 		os.Exit(1)
 	}
 
 	if m, ok := m.(model); ok && m.choice != "" {
-		fmt.Printf("Connected in %v\n", m.connection.startupTime)
-		fmt.Println(m.connection.output)
+		fmt.Print(m.connection.summary())
 
-		args := append([]string{sshExecutableName, m.choice}, sshControlChildOpts...)
+		args := append([]string{sshExecutableName}, m.choiceArgs...)
+		args = append(args, sshControl.childOpts()...)
 		err := syscall.Exec(sshExecutablePath, args, os.Environ())
 		if err != nil {
 			fmt.Println("unable to run executable: %w", err)
 			os.Exit(1)
 		}
-	} else if m.err != "" {
-		fmt.Printf("unable to connect: %s", m.err)
+	} else if m.failure != nil {
+		// Quitting while the failure was shown leaves it behind
+		fmt.Printf("unable to connect: %s\n%s\n", m.failure, m.failure.Stderr)
 		os.Exit(1)
 	}
 }
+
+// loadHosts returns the hosts from every one of 'sources' merged into a
+// single list along with an error for everything that could not be read.
+//
+// When 'resolve' is set the hosts from SSH configurations have their
+// settings resolved through 'ssh -G', which is given 'sshOpts'.
+func loadHosts(ctx context.Context, sources []HostSource, resolve bool, sshOpts []string) ([]list.Item, []error) {
+	lists, errs := loadSources(ctx, sources)
+	if resolve {
+		for n, source := range sources {
+			s, ok := source.(*sshConfigHostSource)
+			if !ok {
+				continue
+			}
+			resolved, resolveErrs := resolveItems(ctx, lists[n], append(s.resolveOpts(), sshOpts...))
+			lists[n] = resolved
+			errs = append(errs, resolveErrs...)
+		}
+	}
+	return mergeItems(lists...), errs
+}
+
+// sourceWarning returns a single line describing 'errs' for the status bar.
+func sourceWarning(errs []error) string {
+	msgs := make([]string, len(errs))
+	for n, err := range errs {
+		msgs[n] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// compareSources prints every difference between the settings parsed from
+// the SSH configurations among 'sources' and those resolved through 'ssh -G'
+// and returns the exit code to use, which is non-zero when any differences
+// were found or a source could not be read.
+func compareSources(sources []HostSource, sshOpts []string) int {
+	ctx := context.Background()
+	localUser := localUsername()
+
+	var (
+		diffs []string
+		code  int
+	)
+	for _, source := range sources {
+		s, ok := source.(*sshConfigHostSource)
+		if !ok {
+			continue
+		}
+		parsed, err := s.Load(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+		}
+		resolved, errs := resolveItems(ctx, parsed, append(s.resolveOpts(), sshOpts...))
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		for n := range parsed {
+			diffs = append(diffs, compareResolved(parsed[n].(Item), resolved[n].(Item), localUser)...)
+		}
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println("No differences found")
+		return code
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	return 1
+}
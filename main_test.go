@@ -1,13 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"charm.land/bubbles/v2/list"
+	tea "charm.land/bubbletea/v2"
 )
 
 func TestSshConfigHosts(t *testing.T) {
@@ -22,7 +34,7 @@ func TestSshConfigHosts(t *testing.T) {
 	}
 	for _, test := range cases {
 		t.Run(test.Description, func(t *testing.T) {
-			hosts, err := sshConfigHosts(test.FilePath)
+			hosts, err := sshConfigHosts(test.FilePath, "testdata")
 
 			if err != nil {
 				t.Fatal(err)
@@ -38,26 +50,26 @@ func TestSshConfigHosts(t *testing.T) {
 	t.Run("expected hosts 'good'", func(t *testing.T) {
 		expected := []list.Item{
 			Item{Host: "darkstar", Hostname: "darkstar.local"},
-			Item{Host: "supernova", Hostname: "supernova.local"},
-			Item{Host: "app1", Hostname: "app.foo.local"},
-			Item{Host: "app2", Hostname: "app.foo.local"},
-			Item{Host: "multiple1", Hostname: "multi1.foo.local"},
-			Item{Host: "multiple2", Hostname: "multi2.foo.local"},
-			Item{Host: "multiple3", Hostname: "multi3.foo.local"},
-			Item{Host: "no.hostname", Hostname: "no.hostname"},
+			Item{Host: "supernova", Hostname: "supernova.local", User: "notme"},
+			Item{Host: "app1", Hostname: "app.foo.local", Port: "2222"},
+			Item{Host: "app2", Hostname: "app.foo.local", User: "someoneelse", Port: "2223"},
+			Item{Host: "multiple1", Hostname: "multi1.foo.local", User: "multi"},
+			Item{Host: "multiple2", Hostname: "multi2.foo.local", User: "multi", Port: "2223"},
+			Item{Host: "multiple3", Hostname: "multi3.foo.local", User: "multi"},
+			Item{Host: "no.hostname", Hostname: "no.hostname", Port: "23231"},
 			Item{Host: "req.tty", Hostname: "req.tty"},
 			Item{Host: "remote.cmd", Hostname: "remote.cmd"},
 			Item{Host: "only.host", Hostname: "only.host"},
 		}
-		hosts, err := sshConfigHosts("testdata/good")
+		hosts, err := sshConfigHosts("testdata/good", "testdata")
 
 		if err != nil {
 			t.Fatal(err)
 		}
 
 		for i := range hosts {
-			if hosts[i].(Item).Host != expected[i].(Item).Host && hosts[i].(Item).Hostname != expected[i].(Item).Hostname {
-				t.Errorf("got %s, wanted %d", hosts[i], expected[i])
+			if !sameHost(hosts[i], expected[i]) {
+				t.Errorf("got %s, wanted %s", hosts[i], expected[i])
 			}
 		}
 	})
@@ -68,7 +80,7 @@ func TestSshConfigHosts(t *testing.T) {
 			Item{Host: "sunday", Hostname: "sunday.local"},
 			Item{Host: "lodestar", Hostname: "lodestar.local"},
 		}
-		hosts, err := sshConfigHosts("testdata/includedTop")
+		hosts, err := sshConfigHosts("testdata/includedTop", "testdata")
 
 		if err != nil {
 			t.Fatal(err)
@@ -77,7 +89,7 @@ func TestSshConfigHosts(t *testing.T) {
 			t.Fatalf("got %d, wanted %d", len(hosts), len(expected))
 		}
 		for i := range hosts {
-			if hosts[i] != expected[i] {
+			if !sameHost(hosts[i], expected[i]) {
 				t.Errorf("got %s, wanted %d", hosts[i], expected[i])
 			}
 		}
@@ -100,8 +112,8 @@ func TestSshConfigHosts(t *testing.T) {
 			t.Fatalf("got %d, wanted %d", len(hosts), len(expected))
 		}
 		for i := range hosts {
-			if hosts[i] != expected[i] {
-				t.Errorf("got %s, wanted %d", hosts[i], expected[i])
+			if !sameHost(hosts[i], expected[i]) {
+				t.Errorf("got %s, wanted %s", hosts[i], expected[i])
 			}
 		}
 	})
@@ -187,7 +199,7 @@ func TestItemToFront(t *testing.T) {
 				t.Errorf("got %d, wanted %d", len(got), len(test.Want))
 			}
 
-			if got[0] != test.Want[0] {
+			if !reflect.DeepEqual(got[0], test.Want[0]) {
 				log.Println(got)
 				t.Errorf("got %s, wanted %s", got[0], test.Want[0])
 			}
@@ -219,7 +231,7 @@ func TestItemsFromJson(t *testing.T) {
 			t.Fatal(err)
 		}
 		for i := range sorted {
-			if sorted[i] != expected[i] {
+			if !reflect.DeepEqual(sorted[i], expected[i]) {
 				t.Errorf("got %s, wanted %d", sorted[i], expected[i])
 			}
 		}
@@ -236,7 +248,7 @@ func TestFindHosts(t *testing.T) {
 		}
 		expected := []list.Item{
 			Item{Host: "saturday1", Hostname: "saturday1.local"},
-			Item{Host: "saturday2", Hostname: "saturday.local"},
+			Item{Host: "saturday2", Hostname: "saturday.local", Port: "2223"},
 			Item{Host: "sunday", Hostname: "sunday.local"},
 		}
 		items := findHosts(content)
@@ -244,9 +256,1859 @@ func TestFindHosts(t *testing.T) {
 			t.Fatalf("got %d, wanted %d", len(items), len(expected))
 		}
 		for i := range items {
-			if items[i].(Item).Host != expected[i].(Item).Host && items[i].(Item).Hostname != expected[i].(Item).Hostname {
-				t.Errorf("got %s, wanted %d", items[i], expected[i])
+			if !sameHost(items[i], expected[i]) {
+				t.Errorf("got %s, wanted %s", items[i], expected[i])
+			}
+		}
+	})
+}
+
+func TestSplitSshConfigLine(t *testing.T) {
+	cases := []struct {
+		Description, Line, Keyword string
+		Args                       []string
+	}{
+		{"blank", "   ", "", nil},
+		{"comment", "  # Host commented", "", nil},
+		{"space separated", "Host darkstar", "host", []string{"darkstar"}},
+		{"lowercase", "hostname darkstar.local", "hostname", []string{"darkstar.local"}},
+		{"equals", "Host=darkstar", "host", []string{"darkstar"}},
+		{"spaced equals", "HostName = darkstar.local", "hostname", []string{"darkstar.local"}},
+		{"tabs", "\tPort\t2222", "port", []string{"2222"}},
+		{"multiple", "Host multiple1 multiple2\tmultiple3", "host", []string{"multiple1", "multiple2", "multiple3"}},
+		{"double quoted", `IdentityFile "~/.ssh/my key"`, "identityfile", []string{"~/.ssh/my key"}},
+		{"single quoted", `RemoteCommand 'tmux new -A'`, "remotecommand", []string{"tmux new -A"}},
+		{"escaped", `SetEnv FOO=\"bar\"`, "setenv", []string{`FOO="bar"`}},
+		{"trailing comment", "User someone # not me", "user", []string{"someone"}},
+		{"ipv6", "HostName fe80::1", "hostname", []string{"fe80::1"}},
+		{"no argument", "HostNameinvalid-because-no-spaces", "hostnameinvalid-because-no-spaces", nil},
+	}
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			keyword, args, err := splitSshConfigLine(test.Line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keyword != test.Keyword {
+				t.Errorf("got %q, wanted %q", keyword, test.Keyword)
+			}
+			if !reflect.DeepEqual(args, test.Args) {
+				t.Errorf("got %q, wanted %q", args, test.Args)
+			}
+		})
+	}
+	t.Run("unterminated quote", func(t *testing.T) {
+		_, _, err := splitSshConfigLine(`HostName "darkstar.local`)
+		if !strings.Contains(fmt.Sprint(err), "unterminated quote") {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestParseSshConfig(t *testing.T) {
+	content, err := os.ReadFile("testdata/syntax")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []list.Item{
+		Item{Host: "equals", Hostname: "equals.local"},
+		Item{Host: "lower", Hostname: "lower.local", User: "some one"},
+		Item{Host: "quoted", Hostname: "quoted.local", Port: "2200"},
+		Item{Host: "spaced one", Hostname: "quoted.local", Port: "2200"},
+		Item{Host: "ipv6", Hostname: "fe80::1", Port: "2222"},
+		Item{Host: "tokens", Hostname: "tokens.tokens.local"},
+	}
+	items := findHosts(content)
+	if len(items) != len(expected) {
+		t.Fatalf("got %d, wanted %d", len(items), len(expected))
+	}
+	for i := range items {
+		if !sameHost(items[i], expected[i]) {
+			t.Errorf("got %s, wanted %s", items[i], expected[i])
+		}
+	}
+	t.Run("description", func(t *testing.T) {
+		got := items[4].(Item).Description()
+		if got != "[fe80::1]:2222" {
+			t.Errorf("got %q, wanted %q", got, "[fe80::1]:2222")
+		}
+	})
+	t.Run("errors", func(t *testing.T) {
+		errs := parseSshConfig(content).Errors
+		if len(errs) != 1 {
+			t.Fatalf("got %d, wanted %d", len(errs), 1)
+		}
+	})
+}
+
+// sameHost reports whether items 'a' and 'b' point to the same host with
+// the same user and port.
+func sameHost(a, b list.Item) bool {
+	i, j := a.(Item), b.(Item)
+	return i.Host == j.Host && i.Hostname == j.Hostname && i.User == j.User && i.Port == j.Port
+}
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		Description, S, Pattern string
+		Want                    bool
+	}{
+		{"literal", "darkstar", "darkstar", true},
+		{"literal mismatch", "darkstar", "supernova", false},
+		{"star", "app.foo.local", "*.foo.local", true},
+		{"star anywhere", "app.foo.local", "app*local", true},
+		{"star empty", "app", "app*", true},
+		{"question mark", "app1", "app?", true},
+		{"question mark too short", "app", "app?", false},
+		{"brackets are literal", "app1", "app[1]", false},
+	}
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			if got := matchPattern(test.S, test.Pattern); got != test.Want {
+				t.Errorf("got %t, wanted %t", got, test.Want)
+			}
+		})
+	}
+	t.Run("negated list", func(t *testing.T) {
+		if matchPatternList("app1", "app*,!app1") {
+			t.Error("got true, wanted false")
+		}
+	})
+}
+
+func TestEffectiveOptions(t *testing.T) {
+	content, err := os.ReadFile("testdata/matching")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu       sync.Mutex
+		executed []string
+	)
+	env := &sshMatchEnv{
+		LocalUser: "tester",
+		Exec: func(command string) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			executed = append(executed, command)
+			return true
+		},
+	}
+	expected := []Item{
+		{Host: "app1", Hostname: "app.foo.local", User: "deploy", ProxyJump: "bastion.foo.local"},
+		{Host: "db1", Hostname: "db1.foo.local", User: "dbadmin", Port: "5022", ProxyJump: "bastion.foo.local"},
+		{Host: "backup", Hostname: "backup.bar.local", User: "fallback", Port: "2200"},
+	}
+	items := parseSshConfig(content).items(env)
+	if len(items) != len(expected) {
+		t.Fatalf("got %d, wanted %d", len(items), len(expected))
+	}
+	for i := range items {
+		got := items[i].(Item)
+		if !sameHost(got, expected[i]) || got.ProxyJump != expected[i].ProxyJump {
+			t.Errorf("got %v, wanted %v", got, expected[i])
+		}
+	}
+	t.Run("exec tokens", func(t *testing.T) {
+		// Hosts are evaluated side by side, so in no particular order
+		want := []string{"test-exec app.foo.local", "test-exec db1.foo.local"}
+		if slices.Sort(executed); !reflect.DeepEqual(executed, want) {
+			t.Errorf("got %q, wanted %q", executed, want)
+		}
+	})
+	t.Run("home token", func(t *testing.T) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			t.Skip(err)
+		}
+		if got := matchValues("app1", nil, env)['d']; got != home {
+			t.Errorf("got %s, wanted %s", got, home)
+		}
+	})
+	t.Run("exec past deadline", func(t *testing.T) {
+		if runMatchExec("true", time.Now().Add(-time.Second)) {
+			t.Error("got command run after the deadline")
+		}
+	})
+	t.Run("negated criterion", func(t *testing.T) {
+		if v := optionValue(items[0].(Item).Options, "identityfile"); v != "" {
+			t.Errorf("got %q, wanted none", v)
+		}
+		if v := optionValue(items[1].(Item).Options, "identityfile"); v != "~/.ssh/tester" {
+			t.Errorf("got %q, wanted %q", v, "~/.ssh/tester")
+		}
+	})
+}
+
+func TestCompareResolved(t *testing.T) {
+	out := []byte("user tester\nhostname app.foo.local\nport 2222\nidentityfile ~/.ssh/id_rsa\nidentityfile ~/.ssh/id_ed25519\nproxyjump bastion\n")
+	resolved := newSshConfigItem("app1", parseResolvedOptions(out))
+	cases := []struct {
+		Description string
+		Parsed      Item
+		Want        int
+	}{
+		{
+			"defaults",
+			newSshConfigItem("app1", []sshOption{
+				{Keyword: "hostname", Args: []string{"app.foo.local"}},
+				{Keyword: "port", Args: []string{"2222"}},
+				{Keyword: "proxyjump", Args: []string{"bastion"}},
+			}),
+			0,
+		},
+		{
+			"mixed case hostname",
+			newSshConfigItem("app1", []sshOption{
+				{Keyword: "hostname", Args: []string{"App.Foo.local"}},
+				{Keyword: "port", Args: []string{"2222"}},
+				{Keyword: "proxyjump", Args: []string{"bastion"}},
+			}),
+			0,
+		},
+		{
+			"disagreeing",
+			newSshConfigItem("app1", []sshOption{
+				{Keyword: "hostname", Args: []string{"app.bar.local"}},
+				{Keyword: "user", Args: []string{"someoneelse"}},
+				{Keyword: "identityfile", Args: []string{"~/.ssh/id_rsa"}},
+			}),
+			5,
+		},
+	}
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			diffs := compareResolved(test.Parsed, resolved, "tester")
+			if len(diffs) != test.Want {
+				log.Println(diffs)
+				t.Errorf("got %d, wanted %d", len(diffs), test.Want)
+			}
+		})
+	}
+	t.Run("implicit user and port", func(t *testing.T) {
+		if _, err := exec.LookPath(sshExecutableName); err != nil {
+			t.Skip("no ssh to resolve with")
+		}
+		items := []list.Item{Item{Host: "nothing.configured", Hostname: "nothing.configured"}}
+		resolved, errs := resolveItems(context.Background(), items, []string{"-F", os.DevNull})
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		if got := resolved[0].(Item); got.User != "" || got.Port != "" {
+			t.Errorf("got user %q and port %q, wanted the defaults left out", got.User, got.Port)
+		}
+	})
+}
+
+func TestInclude(t *testing.T) {
+	expected := []list.Item{
+		Item{Host: "saturday", Hostname: "saturday.local"},
+		Item{Host: "sunday", Hostname: "sunday.local"},
+		Item{Host: "lodestar", Hostname: "lodestar.local"},
+		Item{Host: "cycle", Hostname: "cycle.local"},
+		Item{Host: "conditional", Hostname: "conditional", User: "after.include", Port: "2200"},
+		Item{Host: "inner", Hostname: "inner"},
+		Item{Host: "plain", Hostname: "plain.local"},
+	}
+	for n := 0; n < 2; n++ {
+		t.Run(fmt.Sprintf("run %d", n), func(t *testing.T) {
+			hosts, err := sshConfigHosts("testdata/includeNested", "testdata")
+
+			var incErr *includeError
+			if !errors.As(err, &incErr) {
+				t.Fatalf("got %v, wanted include error", err)
+			}
+			if len(incErr.errs) != 2 {
+				t.Errorf("got %d, wanted %d: %v", len(incErr.errs), 2, incErr)
+			}
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("got %v, wanted missing file", err)
+			}
+			if len(hosts) != len(expected) {
+				t.Fatalf("got %d, wanted %d", len(hosts), len(expected))
+			}
+			for i := range hosts {
+				if !sameHost(hosts[i], expected[i]) {
+					t.Errorf("got %s, wanted %s", hosts[i], expected[i])
+				}
+			}
+		})
+	}
+	t.Run("missing top level", func(t *testing.T) {
+		_, err := sshConfigHosts("testdata/missing", "testdata")
+		var incErr *includeError
+		if err == nil || errors.As(err, &incErr) {
+			t.Fatalf("got %v, wanted read error", err)
+		}
+	})
+	t.Run("empty pattern", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config")
+		if err := os.WriteFile(path, []byte("Include \"\"\n\nHost example\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		hosts, err := sshConfigHosts(path, "testdata")
+		var incErr *includeError
+		if !errors.As(err, &incErr) || len(incErr.errs) != 1 {
+			t.Fatalf("got %v, wanted one include error", err)
+		}
+		if len(hosts) != 1 {
+			t.Errorf("got %d, wanted %d", len(hosts), 1)
+		}
+	})
+}
+
+func TestFindIniHosts(t *testing.T) {
+	content, err := os.ReadFile("testdata/inventory.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []list.Item{
+		Item{Host: "bastion.local", Hostname: "bastion.local", User: "jump"},
+		Item{Host: "web01.local", Hostname: "web01.local", User: "deploy", Groups: []string{"prod", "web"}},
+		Item{Host: "web02.local", Hostname: "web02.local", User: "deploy", Groups: []string{"prod", "web"}},
+		Item{Host: "web03.local", Hostname: "web03.local", User: "deploy", Groups: []string{"prod", "web"}},
+		Item{Host: "app.local", Hostname: "app", User: "deploy", Port: "2222", Groups: []string{"prod", "web"}},
+		Item{Host: "db-a.local", Hostname: "db-a.local", User: "db admin", Port: "5432", Groups: []string{"db", "prod"}},
+		Item{Host: "db-b.local", Hostname: "db-b.local", User: "db admin", Port: "5432", Groups: []string{"db", "prod"}},
+	}
+	items, err := findIniHosts(content, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != len(expected) {
+		t.Fatalf("got %d, wanted %d", len(items), len(expected))
+	}
+	for i := range items {
+		if !sameHost(items[i], expected[i]) || !reflect.DeepEqual(items[i].(Item).Groups, expected[i].(Item).Groups) {
+			t.Errorf("got %s, wanted %s", items[i], expected[i])
+		}
+	}
+	t.Run("inherited vars", func(t *testing.T) {
+		if got := items[1].(Item).Vars["env"]; got != "production" {
+			t.Errorf("got %q, wanted %q", got, "production")
+		}
+	})
+	t.Run("connect args", func(t *testing.T) {
+		want := []string{"-l", "deploy", "-p", "2222", "-i", expandTilde("~/.ssh/deploy"), "app.local"}
+		if got := items[4].(Item).connectArgs(); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %q, wanted %q", got, want)
+		}
+	})
+}
+
+func TestExpandHostRange(t *testing.T) {
+	cases := []struct {
+		Description, Pattern string
+		Want                 []string
+	}{
+		{"no range", "web.local", []string{"web.local"}},
+		{"numeric", "web[1:3]", []string{"web1", "web2", "web3"}},
+		{"padded", "web[08:10].local", []string{"web08.local", "web09.local", "web10.local"}},
+		{"stride", "web[0:6:3]", []string{"web0", "web3", "web6"}},
+		{"alphabetic", "db-[a:c]", []string{"db-a", "db-b", "db-c"}},
+		{"multiple", "r[1:2]n[a:b]", []string{"r1na", "r1nb", "r2na", "r2nb"}},
+	}
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			got, err := expandHostRange(test.Pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("got %q, wanted %q", got, test.Want)
+			}
+		})
+	}
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := expandHostRange("web[1:a]"); err == nil {
+			t.Error("got nil, wanted error")
+		}
+	})
+}
+
+func TestYamlHosts(t *testing.T) {
+	expected, err := iniHosts("testdata/inventory.ini", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := yamlHosts("testdata/inventory.yml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != len(expected) {
+		t.Fatalf("got %d, wanted %d", len(items), len(expected))
+	}
+	for i := range items {
+		// Both files list the same hosts, just on different lines
+		got, want := items[i].(Item), expected[i].(Item)
+		got.Origins, want.Origins = nil, nil
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, wanted %v", got, want)
+		}
+	}
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parseYamlInventory([]byte("all:\n  hosts:\n    - web01\n"))
+		if !strings.Contains(fmt.Sprint(err), "expected a mapping") {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestInventoryFormat(t *testing.T) {
+	cases := []struct {
+		Description, FilePath, Format, Want string
+	}{
+		{"ini extension", "hosts.ini", "", "ini"},
+		{"no extension", "hosts", "", "ini"},
+		{"yaml extension", "hosts.yaml", "", "yaml"},
+		{"yml extension", "hosts.YML", "", "yaml"},
+		{"explicit", "hosts", "yaml", "yaml"},
+	}
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			got, err := inventoryFormat(test.FilePath, test.Format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.Want {
+				t.Errorf("got %s, wanted %s", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestParseJsonInventory(t *testing.T) {
+	cases := []struct {
+		Description, FilePath string
+		Want                  []list.Item
+	}{
+		{
+			"ansible-inventory",
+			"testdata/inventory.json",
+			[]list.Item{
+				Item{Host: "bastion.local", Hostname: "bastion.local", User: "nobody"},
+				Item{Host: "web01.local", Hostname: "web01.local", User: "deploy", Groups: []string{"prod", "web"}},
+				Item{Host: "app.local", Hostname: "app", User: "deploy", Port: "2222", Groups: []string{"prod", "web"}},
+				Item{Host: "db-a.local", Hostname: "db-a.local", User: "deploy", Groups: []string{"db", "prod"}},
+				Item{Host: "lonely.local", Hostname: "lonely.local", User: "alone"},
+			},
+		},
+		{
+			// As with every inventory the address is the title and
+			// the inventory name is shown in the description
+			"host list titled by address",
+			"testdata/hostlist.json",
+			[]list.Item{
+				Item{Host: "10.0.0.1", Hostname: "web01", User: "deploy", Port: "2222", Groups: []string{"web"}},
+				Item{Host: "10.0.0.2", Hostname: "db01"},
+			},
+		},
+	}
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			content, err := os.ReadFile(test.FilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			inv, err := parseJsonInventory(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			items := inv.items(false)
+			if len(items) != len(test.Want) {
+				t.Fatalf("got %d, wanted %d", len(items), len(test.Want))
+			}
+			for i := range items {
+				if !sameHost(items[i], test.Want[i]) || !reflect.DeepEqual(items[i].(Item).Groups, test.Want[i].(Item).Groups) {
+					t.Errorf("got %s, wanted %s", items[i], test.Want[i])
+				}
+			}
+		})
+	}
+	t.Run("non-string vars", func(t *testing.T) {
+		content, _ := os.ReadFile("testdata/inventory.json")
+		inv, _ := parseJsonInventory(content)
+		vars := inv.items(false)[1].(Item).Vars
+		if vars["replicas"] != "3" || vars["tags"] != `["a","b"]` {
+			t.Errorf("got %q and %q", vars["replicas"], vars["tags"])
+		}
+	})
+	t.Run("command", func(t *testing.T) {
+		items, err := commandHosts(context.Background(), "cat testdata/hostlist.json", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"-J", "bastion", "10.0.0.2"}
+		if got := items[1].(Item).connectArgs(); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %q, wanted %q", got, want)
+		}
+	})
+	t.Run("failing command", func(t *testing.T) {
+		_, err := commandHosts(context.Background(), "echo oops >&2; exit 3", false)
+		if !strings.Contains(fmt.Sprint(err), "oops") {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestFindKnownHosts(t *testing.T) {
+	items, err := knownHostsHosts("testdata/known_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []list.Item{
+		Item{Host: "github.com", Hostname: "github.com", KeyType: "ssh-ed25519, ecdsa-sha2-nistp256"},
+		Item{Host: "140.82.121.4", Hostname: "140.82.121.4", KeyType: "ecdsa-sha2-nistp256"},
+		Item{Host: "git.example.com", Hostname: "git.example.com", Port: "2222", KeyType: "ssh-ed25519"},
+		Item{Host: "legacy.example.com", Hostname: "legacy.example.com", KeyType: "ssh-rsa"},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("got %d, wanted %d", len(items), len(want))
+	}
+	for i := range items {
+		if !sameHost(items[i], want[i]) || items[i].(Item).KeyType != want[i].(Item).KeyType {
+			t.Errorf("got %v, wanted %v", items[i], want[i])
+		}
+	}
+	t.Run("connect args", func(t *testing.T) {
+		want := []string{"-p", "2222", "git.example.com"}
+		if got := items[2].(Item).connectArgs(); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %q, wanted %q", got, want)
+		}
+	})
+}
+
+func TestMergeItems(t *testing.T) {
+	config := []list.Item{
+		Item{Host: "gh", Hostname: "github.com", Origins: []itemOrigin{{Source: sshConfigSource}}},
+		Item{Host: "git", Hostname: "git.example.com", Origins: []itemOrigin{{Source: sshConfigSource}}},
+		Item{Host: "gh-work", Hostname: "github.com", Origins: []itemOrigin{{Source: sshConfigSource}}},
+	}
+	known := []list.Item{
+		Item{Host: "github.com", Hostname: "GitHub.com", KeyType: "ssh-ed25519", Origins: []itemOrigin{{Source: knownHostsSource}}},
+		Item{Host: "git.example.com", Hostname: "git.example.com", Port: "2222", KeyType: "ssh-ed25519", Origins: []itemOrigin{{Source: knownHostsSource}}},
+	}
+	items := mergeItems(config, known)
+
+	cases := []struct {
+		Description string
+		Got         Item
+		Want        string
+	}{
+		{"merged", items[0].(Item), "(ssh_config, known_hosts) github.com :: ssh-ed25519"},
+		{"different port", items[1].(Item), "(ssh_config) git.example.com"},
+		{"alias in same source", items[2].(Item), "(ssh_config) github.com"},
+		{"known only", items[3].(Item), "(known_hosts) git.example.com:2222 :: ssh-ed25519"},
+	}
+	if len(items) != len(cases) {
+		t.Fatalf("got %d, wanted %d", len(items), len(cases))
+	}
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			if got := test.Got.Description(); got != test.Want {
+				t.Errorf("got %q, wanted %q", got, test.Want)
+			}
+		})
+	}
+	if got := items[0].(Item).Host; got != "gh" {
+		t.Errorf("got %s, wanted gh", got)
+	}
+	t.Run("known_hosts and inventory", func(t *testing.T) {
+		inventory := []list.Item{Item{Host: "10.0.0.1", Hostname: "web01", Origins: []itemOrigin{{Source: inventorySource}}}}
+		known := []list.Item{Item{Host: "10.0.0.1", Hostname: "10.0.0.1", KeyType: "ssh-ed25519", Origins: []itemOrigin{{Source: knownHostsSource}}}}
+		items := mergeItems(inventory, known)
+		if len(items) != 1 {
+			t.Fatalf("got %d, wanted %d", len(items), 1)
+		}
+		if got := items[0].(Item); got.Hostname != "web01" || got.KeyType != "ssh-ed25519" || got.sources() != "inventory, known_hosts" {
+			t.Errorf("got %+v, wanted the known host merged into the inventory host", got)
+		}
+	})
+	t.Run("inventory and ssh_config", func(t *testing.T) {
+		inventory := []list.Item{Item{Host: "10.0.0.1", Hostname: "web01", User: "deploy", Origins: []itemOrigin{{Source: inventorySource}}}}
+		config := []list.Item{Item{Host: "web01", Hostname: "10.0.0.1", Origins: []itemOrigin{{Source: sshConfigSource}}}}
+		items := mergeItems(inventory, config)
+		if len(items) != 1 {
+			t.Fatalf("got %d, wanted %d", len(items), 1)
+		}
+		if got := items[0].(Item); got.User != "deploy" || got.sources() != "inventory, ssh_config" {
+			t.Errorf("got %+v, wanted the inventory host merged with the configured one", got)
+		}
+	})
+}
+
+// A staticHostSource is a 'HostSource' registered only for tests, which
+// returns a single host named after its value.
+type staticHostSource struct {
+	name, value string
+}
+
+func (s staticHostSource) Name() string { return s.name }
+
+func (s staticHostSource) Load(ctx context.Context) ([]list.Item, error) {
+	return []list.Item{Item{Host: s.value, Hostname: s.value}}, errors.New("partial")
+}
+
+func init() {
+	registerHostSource("static", func(name, value string, opts sourceOptions) (HostSource, error) {
+		return staticHostSource{name: name, value: value}, nil
+	})
+}
+
+func TestSources(t *testing.T) {
+	t.Run("parse", func(t *testing.T) {
+		cases := []struct {
+			Description string
+			Value       string
+			Want        sourceSpec
+			WantErr     bool
+		}{
+			{"kind only", "ssh_config", sourceSpec{Kind: sshConfigSource, Label: sshConfigSource}, false},
+			{"kind and path", "inventory:hosts.ini", sourceSpec{Kind: inventorySource, Value: "hosts.ini", Label: inventorySource}, false},
+			{"command with colons", "command:echo a:b", sourceSpec{Kind: commandSource, Value: "echo a:b", Label: commandSource}, false},
+			{"registered elsewhere", "static:example", sourceSpec{Kind: "static", Value: "example", Label: "static"}, false},
+			{"unknown kind", "ldap:example", sourceSpec{}, true},
+		}
+		for _, test := range cases {
+			t.Run(test.Description, func(t *testing.T) {
+				got, err := parseSourceSpec(test.Value)
+				if (err != nil) != test.WantErr || got != test.Want {
+					t.Errorf("got %v (%v), wanted %v", got, err, test.Want)
+				}
+			})
+		}
+	})
+	t.Run("missing value", func(t *testing.T) {
+		_, err := sourceSpec{Kind: inventorySource, Label: inventorySource}.open(sourceOptions{})
+		if !strings.Contains(fmt.Sprint(err), "missing path") {
+			t.Fatal(err)
+		}
+	})
+	t.Run("labels and precedence", func(t *testing.T) {
+		specs := []sourceSpec{
+			{Kind: inventorySource, Value: "testdata/inventory.ini"},
+			{Kind: sshConfigSource},
+			{Kind: inventorySource, Value: "testdata/inventory.yml"},
+		}
+		labelSources(specs)
+		if err := sortByPrecedence(specs, "ssh_config,inventory:inventory.yml"); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"ssh_config", "inventory:inventory.yml", "inventory:inventory.ini"}
+		for n := range want {
+			if specs[n].Label != want[n] {
+				t.Errorf("got %s, wanted %s", specs[n].Label, want[n])
 			}
 		}
+		if err := sortByPrecedence(specs, "known_hosts"); err == nil {
+			t.Error("got no error for unknown source")
+		}
+	})
+	t.Run("origins", func(t *testing.T) {
+		cases := []struct {
+			Description string
+			Spec        sourceSpec
+			Want        string
+		}{
+			{"ssh config", sourceSpec{Kind: sshConfigSource, Value: "testdata/good", Label: "ssh_config"}, "ssh_config testdata/good:"},
+			{"inventory", sourceSpec{Kind: inventorySource, Value: "testdata/inventory.ini", Label: "ini"}, "ini testdata/inventory.ini:"},
+			{"yaml inventory", sourceSpec{Kind: inventorySource, Value: "testdata/inventory.yml", Label: "yaml"}, "yaml testdata/inventory.yml:"},
+			{"known hosts", sourceSpec{Kind: knownHostsSource, Value: "testdata/known_hosts", Label: "known_hosts"}, "known_hosts testdata/known_hosts:3"},
+			{"without origin", sourceSpec{Kind: "static", Value: "example", Label: "static"}, "static"},
+		}
+		for _, test := range cases {
+			t.Run(test.Description, func(t *testing.T) {
+				source, err := test.Spec.open(sourceOptions{IncludeDir: "testdata"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				lists, _ := loadSources(context.Background(), []HostSource{source})
+				got := lists[0][0].(Item).Origins[0].String()
+				if !strings.HasPrefix(got, test.Want) || strings.HasSuffix(got, ":0") {
+					t.Errorf("got %s, wanted %s", got, test.Want)
+				}
+			})
+		}
+	})
+	t.Run("errors per source", func(t *testing.T) {
+		missing, _ := sourceSpec{Kind: knownHostsSource, Value: "testdata/missing", Label: "known_hosts"}.open(sourceOptions{})
+		static := staticHostSource{name: "static", value: "example"}
+		lists, errs := loadSources(context.Background(), []HostSource{missing, static})
+		if len(errs) != 2 || len(lists[0]) != 0 || len(lists[1]) != 1 {
+			t.Errorf("got %d errors and %d lists, wanted 2 errors with hosts kept", len(errs), len(lists))
+		}
+	})
+	t.Run("watched files", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config")
+		var w watchedFiles
+		w.setFiles(path)
+		missing := w.modTimes()
+
+		if err := os.WriteFile(path, []byte("Host example\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		created := w.modTimes()
+		if !filesChanged(missing, created) {
+			t.Error("got no change after creating file")
+		}
+
+		w.setFiles(path, filepath.Join(t.TempDir(), "included"))
+		if filesChanged(created, w.modTimes()) {
+			t.Error("got change after adding file to watch")
+		}
+
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+		if !filesChanged(created, w.modTimes()) {
+			t.Error("got no change after modifying file")
+		}
+	})
+}
+
+func TestProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			fmt.Fprint(conn, "Welcome\r\nSSH-2.0-OpenSSH_9.6\r\n")
+			conn.Close()
+		}
+	}()
+
+	t.Run("banner", func(t *testing.T) {
+		host, port, _ := net.SplitHostPort(l.Addr().String())
+		i := Item{Host: "local", Hostname: host, Port: port}
+		result := probeItem(context.Background(), i, nil, time.Second)
+		if result.Err != nil || result.Banner != "SSH-2.0-OpenSSH_9.6" {
+			t.Errorf("got %v, wanted banner", result)
+		}
+	})
+	t.Run("closed port", func(t *testing.T) {
+		closed, _ := net.Listen("tcp", "127.0.0.1:0")
+		address := closed.Addr().String()
+		closed.Close()
+		if result := probeTCP(context.Background(), address); result.Err == nil {
+			t.Errorf("got %v, wanted error", result)
+		}
+	})
+	t.Run("no banner", func(t *testing.T) {
+		if _, err := readBanner(strings.NewReader("HTTP/1.1 400 Bad Request\r\n\r\n")); err == nil {
+			t.Error("got no error")
+		}
+	})
+	t.Run("address", func(t *testing.T) {
+		cases := []struct {
+			Description string
+			Item        Item
+			Want        string
+		}{
+			{"ssh config", Item{Host: "web", Hostname: "10.0.0.1", Port: "2222", Origins: []itemOrigin{{Source: sshConfigSource}}}, "10.0.0.1:2222"},
+			{"inventory", Item{Host: "10.0.0.2", Hostname: "db01", Origins: []itemOrigin{{Source: inventorySource}}}, "10.0.0.2:22"},
+			{"ipv6", Item{Host: "v6", Hostname: "::1"}, "[::1]:22"},
+		}
+		for _, test := range cases {
+			t.Run(test.Description, func(t *testing.T) {
+				if got := test.Item.probeAddress(); got != test.Want {
+					t.Errorf("got %s, wanted %s", got, test.Want)
+				}
+			})
+		}
+	})
+	t.Run("proxy args", func(t *testing.T) {
+		cases := []struct {
+			Description string
+			ProxyJump   string
+			Want        []string
+		}{
+			{"single", "bastion", []string{"-W", "db:22", "bastion"}},
+			{"chain", "outer,user@inner:2222", []string{"-W", "db:22", "-J", "outer", "ssh://user@inner:2222"}},
+		}
+		for _, test := range cases {
+			t.Run(test.Description, func(t *testing.T) {
+				got := proxyProbeArgs("db:22", test.ProxyJump, nil)
+				want := append(test.Want[:len(test.Want)-1:len(test.Want)-1], "-o", "BatchMode=yes")
+				want = append(append(want, sshControl.parentOpts(Item{})...), test.Want[len(test.Want)-1])
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("got %q, wanted %q", got, want)
+				}
+			})
+		}
+	})
+}
+
+func TestParsePingOutput(t *testing.T) {
+	cases := []struct {
+		Description, FilePath string
+		Received              int
+		Loss                  float64
+		Avg                   time.Duration
+		Samples               int
+	}{
+		{"linux", "testdata/ping/linux", 3, 25, 11730 * time.Microsecond, 3},
+		{"bsd", "testdata/ping/bsd", 2, 0, 11502 * time.Microsecond, 2},
+		{"busybox", "testdata/ping/busybox", 1, 0, 64 * time.Microsecond, 1},
+		{"unreachable", "testdata/ping/unreachable", 0, 100, 0, 0},
+	}
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			content, err := os.ReadFile(test.FilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parsePingOutput(strings.Split(string(content), "\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Received != test.Received || got.Loss != test.Loss || got.Avg != test.Avg || len(got.Samples) != test.Samples {
+				t.Errorf("got %+v, wanted %d received, %g%% loss, %v average, and %d samples", got, test.Received, test.Loss, test.Avg, test.Samples)
+			}
+		})
+	}
+	t.Run("no statistics", func(t *testing.T) {
+		if _, err := parsePingOutput([]string{"", "ping: unknown host"}); err == nil {
+			t.Error("got no error")
+		}
+	})
+	t.Run("sparkline", func(t *testing.T) {
+		samples := []time.Duration{10 * time.Millisecond, 17 * time.Millisecond, 13 * time.Millisecond}
+		if got, want := sparkline(samples), "▁█▄"; got != want {
+			t.Errorf("got %s, wanted %s", got, want)
+		}
+		if got, want := sparkline(samples[:1]), "▁"; got != want {
+			t.Errorf("got %s, wanted %s", got, want)
+		}
+	})
+}
+
+func TestSweep(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			fmt.Fprint(conn, "SSH-2.0-OpenSSH_9.6\r\n")
+			conn.Close()
+		}
+	}()
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddress := closed.Addr().String()
+	closed.Close()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	_, closedPort, _ := net.SplitHostPort(closedAddress)
+	up := Item{Host: "up", Hostname: host, Port: port}
+	alias := Item{Host: "alias", Hostname: host, Port: port}
+	down := Item{Host: "down", Hostname: host, Port: closedPort}
+
+	t.Run("results", func(t *testing.T) {
+		s := &sweeper{workers: 2, rate: 100, timeout: time.Second, probe: tcpProbe}
+		cmd := s.start([]list.Item{up, alias, down})
+		got := make(map[string]reachability)
+		for msg := cmd(); ; msg = cmd() {
+			if done, ok := msg.(sweepDoneMsg); ok {
+				s.done(done.results)
+				break
+			}
+			result := msg.(sweepResultMsg)
+			got[result.address] = result.status.State
+			cmd = waitForSweepResult(result.results)
+		}
+		want := map[string]reachability{up.probeAddress(): reachUp, down.probeAddress(): reachDown}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, wanted %v", got, want)
+		}
+		if s.running() {
+			t.Error("got sweep still running")
+		}
+	})
+	t.Run("stop", func(t *testing.T) {
+		s := &sweeper{workers: 1, rate: 1, timeout: time.Second, probe: tcpProbe}
+		cmd := s.start([]list.Item{up, down})
+		s.stop()
+		if _, ok := cmd().(sweepDoneMsg); !ok {
+			t.Error("got result, wanted sweep to be done")
+		}
+	})
+	t.Run("cache", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wishlistlite", "status.json")
+		empty, err := loadStatusCache(path)
+		if err != nil || len(empty) != 0 {
+			t.Fatalf("got %v, %v, wanted empty cache", empty, err)
+		}
+
+		fresh := hostStatus{State: reachUp, Latency: time.Millisecond, Checked: time.Now().UTC().Round(0)}
+		stale := hostStatus{State: reachDown, Checked: time.Now().Add(-time.Hour).UTC().Round(0)}
+		cache := statusCache{up.probeAddress(): fresh, down.probeAddress(): stale}
+		if err := cache.save(path); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := loadStatusCache(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		items := loaded.apply([]list.Item{up, alias, down}, time.Minute)
+		for n, want := range []*hostStatus{&fresh, &fresh, nil} {
+			got := items[n].(Item).Status
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, wanted %v for %s", got, want, items[n].(Item).Host)
+			}
+		}
+	})
+}
+
+func TestLivePing(t *testing.T) {
+	t.Run("record", func(t *testing.T) {
+		start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		l := &livePing{}
+		for n, s := range []hostStatus{
+			{State: reachUp, Latency: 2 * time.Millisecond},
+			{State: reachUp, Latency: 4 * time.Millisecond},
+			{State: reachDown},
+			{State: reachDown},
+			{State: reachUp, Latency: 3 * time.Millisecond},
+		} {
+			s.Checked = start.Add(time.Duration(n) * time.Second)
+			l.record(s)
+		}
+
+		want := "3/5 received, 40.0% loss, rtt min/avg/max 2ms/3ms/4ms"
+		if got := l.String(); got != want {
+			t.Errorf("got %s, wanted %s", got, want)
+		}
+		wantTransitions := []liveTransition{
+			{At: start, State: reachUp},
+			{At: start.Add(2 * time.Second), State: reachDown},
+			{At: start.Add(4 * time.Second), State: reachUp},
+		}
+		if !reflect.DeepEqual(l.transitions, wantTransitions) {
+			t.Errorf("got %v, wanted %v", l.transitions, wantTransitions)
+		}
+	})
+	t.Run("bounded history", func(t *testing.T) {
+		l := &livePing{}
+		for n := range maxLiveSamples + 10 {
+			state := reachUp
+			if n%2 == 1 {
+				state = reachDown
+			}
+			l.record(hostStatus{State: state})
+		}
+		if len(l.history) != maxLiveSamples || len(l.transitions) != maxLiveTransitions+1 {
+			t.Errorf("got %d samples and %d transitions, wanted %d and %d", len(l.history), len(l.transitions), maxLiveSamples, maxLiveTransitions+1)
+		}
+	})
+	t.Run("until stopped", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				fmt.Fprint(conn, "SSH-2.0-OpenSSH_9.6\r\n")
+				conn.Close()
+			}
+		}()
+
+		host, port, _ := net.SplitHostPort(l.Addr().String())
+		live := &livePing{item: Item{Host: "local", Hostname: host, Port: port}, interval: time.Millisecond, timeout: time.Second, probe: tcpProbe}
+		cmd := live.start()
+		for range 3 {
+			msg, ok := cmd().(liveResultMsg)
+			if !ok || msg.status.State != reachUp {
+				t.Fatalf("got %v, wanted host to be up", msg)
+			}
+			live.record(msg.status)
+			cmd = waitForLiveResult(msg.results)
+		}
+		live.stop()
+		if msg := cmd(); msg != nil {
+			t.Errorf("got %v after stopping, wanted nothing", msg)
+		}
+	})
+}
+
+func TestJobs(t *testing.T) {
+	t.Run("results go to their own job", func(t *testing.T) {
+		linux, _ := os.ReadFile("testdata/ping/linux")
+		bsd, _ := os.ReadFile("testdata/ping/bsd")
+		items := []list.Item{
+			Item{Host: "first", Hostname: "10.0.0.1"},
+			Item{Host: "second", Hostname: "10.0.0.2"},
+		}
+		m := newModel(items, []list.Item{}, "", pingOpts, nil)
+		first, _ := m.jobs.start(pingJob, items[0].(Item), 0, "")
+		second, _ := m.jobs.start(pingJob, items[1].(Item), 1, "")
+
+		// The later job finishing first must not be mistaken for the earlier one
+		updated, _ := m.Update(pingJobMsg{id: second.ID, commandResult: commandResult{output: strings.Split(string(bsd), "\n")}})
+		updated, _ = updated.Update(pingJobMsg{id: first.ID, commandResult: commandResult{output: strings.Split(string(linux), "\n")}})
+		m = updated.(model)
+
+		for n, want := range []int{3, 2} {
+			i := m.list.Items()[n].(Item)
+			if i.Ping == nil || i.Ping.Received != want {
+				t.Errorf("got %+v, wanted %d received for %s", i.Ping, want, i.Host)
+			}
+		}
+		if len(m.jobs.jobs) != 0 {
+			t.Errorf("got %d jobs, wanted none", len(m.jobs.jobs))
+		}
+	})
+	t.Run("canceled", func(t *testing.T) {
+		var jobs jobManager
+		jb, ctx := jobs.start(pingJob, Item{Host: "slow"}, 0, "")
+		if !jobs.cancel(jb.ID) || ctx.Err() == nil {
+			t.Error("got job still running")
+		}
+		if _, ok := jobs.finish(jb.ID); ok {
+			t.Error("got result of canceled job")
+		}
+	})
+	t.Run("killed", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+		start := time.Now()
+		runCommand(ctx, "sleep", true, "10")
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("got command running for %v, wanted it killed", elapsed)
+		}
+	})
+}
+
+func TestConnectRecentlyUsed(t *testing.T) {
+	inventoryItem := Item{
+		Host:     "10.0.0.7",
+		Hostname: "db01",
+		User:     "deploy",
+		Port:     "2222",
+		Origins:  []itemOrigin{{Source: inventorySource}},
+		Vars:     map[string]string{"ansible_ssh_private_key_file": "/keys/deploy"},
+	}
+	items := []list.Item{Item{Host: "web", Hostname: "10.0.0.5"}, inventoryItem}
+	cases := []struct {
+		Description string
+		Recent      Item
+		Want        []string
+	}{
+		{"inventory", Item{Host: "10.0.0.7", Hostname: "db01", Timestamp: "Sun, 12 Jun 2022 14:59:28 EEST"}, []string{"-l", "deploy", "-p", "2222", "-i", "/keys/deploy", "10.0.0.7"}},
+		{"ad hoc", Item{Host: "adhoc", Hostname: "adhoc", Timestamp: "Sun, 12 Jun 2022 14:59:28 EEST"}, []string{"adhoc"}},
+	}
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			m := newModel(items, []list.Item{test.Recent}, "", pingOpts, nil)
+			updated, _ := m.Update(tea.KeyPressMsg{Code: 'r', Text: "r"})
+			updated, _ = updated.(model).Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+			m = updated.(model)
+			if !m.sorted || !reflect.DeepEqual(m.choiceArgs, test.Want) {
+				t.Errorf("got %q, wanted %q", m.choiceArgs, test.Want)
+			}
+		})
+	}
+}
+
+func TestCancelConnect(t *testing.T) {
+	t.Run("control path", func(t *testing.T) {
+		options := []sshOption{
+			{Keyword: "hostname", Args: []string{"10.0.0.1"}},
+			{Keyword: "port", Args: []string{"2222"}},
+			{Keyword: "user", Args: []string{"admin"}},
+		}
+		want := "/dev/shm/control:10.0.0.1:2222:admin%"
+		if got := expandControlPath("/dev/shm/control:%h:%p:%r%%", options); got != want {
+			t.Errorf("got %s, wanted %s", got, want)
+		}
+	})
+	t.Run("stale socket", func(t *testing.T) {
+		dir := t.TempDir()
+		stale := filepath.Join(dir, "stale")
+		l, err := net.Listen("unix", stale)
+		if err != nil {
+			t.Skip(err)
+		}
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		l.Close()
+
+		live := filepath.Join(dir, "live")
+		ll, err := net.Listen("unix", live)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ll.Close()
+
+		for _, path := range []string{stale, live, filepath.Join(dir, "missing")} {
+			if _, err := removeStaleSocket(path); err != nil {
+				t.Errorf("got %v for %s", err, path)
+			}
+		}
+		if _, err := os.Stat(stale); !errors.Is(err, os.ErrNotExist) {
+			t.Error("got stale socket kept")
+		}
+		if _, err := os.Stat(live); err != nil {
+			t.Errorf("got live socket removed: %v", err)
+		}
+	})
+	t.Run("escape", func(t *testing.T) {
+		i := Item{Host: "slow", Hostname: "10.0.0.1"}
+		m := newModel([]list.Item{i}, []list.Item{}, "", pingOpts, nil)
+		m.connection.state = "Connecting"
+		m.choice = i.Host
+		_, ctx := m.jobs.start(connectJob, i, 0, "")
+
+		updated, _ := m.Update(tea.KeyPressMsg{Code: tea.KeyEscape})
+		m = updated.(model)
+		if m.connection.state == "Connecting" || m.choice != "" || len(m.jobs.jobs) != 0 || ctx.Err() == nil {
+			t.Errorf("got state %q, choice %q, and %d jobs, wanted connecting canceled", m.connection.state, m.choice, len(m.jobs.jobs))
+		}
+	})
+}
+
+func TestClassifyFailure(t *testing.T) {
+	cases := []struct {
+		Description string
+		Stderr      string
+		ViaJump     bool
+		Want        string
+	}{
+		{"dns", "ssh: Could not resolve hostname web.example: Name or service not known\r\n", false, "DNS resolution failed"},
+		{"dns macos", "ssh: Could not resolve hostname web.example: nodename nor servname provided, or not known\r\n", false, "DNS resolution failed"},
+		{"refused", "ssh: connect to host 10.0.0.1 port 22: Connection refused\r\n", false, "connection refused"},
+		{"timeout", "ssh: connect to host 10.0.0.1 port 22: Connection timed out\r\n", false, "connection timed out"},
+		{"publickey", "admin@10.0.0.1: Permission denied (publickey).\r\n", false, "permission denied (publickey)"},
+		{"publickey and password", "admin@10.0.0.1: Permission denied (publickey,password).\r\n", false, "permission denied (publickey)"},
+		{"too many failures", "Received disconnect from 10.0.0.1 port 22:2: Too many authentication failures\r\nDisconnected from 10.0.0.1 port 22\r\n", false, "too many authentication failures"},
+		{"host key changed", "@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\r\n@    WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!     @\r\n@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\r\nHost key verification failed.\r\n", false, "host key changed"},
+		{"jump host refused", "ssh: connect to host bastion port 22: Connection refused\r\nConnection closed by UNKNOWN port 65535\r\n", true, "ProxyJump failed"},
+		{"jump host can't reach", "channel 0: open failed: connect failed: No route to host\r\nstdio forwarding failed\r\n", true, "ProxyJump failed"},
+		{"unknown host key", "No ED25519 host key is known for web.example and you have requested strict checking.\r\nHost key verification failed.\r\n", false, "unknown host key"},
+		{"unknown host key in batch mode", "Host key verification failed.\r\n", false, "unknown host key"},
+		{"closed during handshake", "kex_exchange_identification: Connection closed by remote host\r\nConnection closed by 10.0.0.1 port 22\r\n", false, "connection closed during handshake"},
+		{"closed during handshake via jump", "kex_exchange_identification: Connection closed by remote host\r\nConnection closed by UNKNOWN port 65535\r\n", true, "ProxyJump failed"},
+		{"unknown", "something else entirely\r\n", false, "connection failed"},
+	}
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			if got := classifyFailure(test.Stderr, test.ViaJump).Summary; got != test.Want {
+				t.Errorf("got %s, wanted %s", got, test.Want)
+			}
+		})
+	}
+	t.Run("panel", func(t *testing.T) {
+		i := Item{Host: "web", Hostname: "10.0.0.1"}
+		m := newModel([]list.Item{i}, []list.Item{}, "", pingOpts, nil)
+		m.connection.state = "Connecting"
+		m.choice = i.Host
+		jb, _ := m.jobs.start(connectJob, i, 0, "")
+
+		updated, _ := m.Update(connectJobMsg{id: jb.ID, commandResult: commandResult{stderr: "ssh: connect to host 10.0.0.1 port 22: Connection refused\r\n", exitCode: 255}})
+		m = updated.(model)
+		if m.connection.state != "Failed" || m.choice != "" || m.failure == nil || m.failure.ExitCode != 255 {
+			t.Fatalf("got state %q and failure %v, wanted failure shown", m.connection.state, m.failure)
+		}
+
+		updated, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyEscape})
+		m = updated.(model)
+		want := `"web" connection refused (exit code 255)`
+		if m.connection.state != "Pinged" || m.connection.output != want {
+			t.Errorf("got state %q and %q, wanted %q in status bar", m.connection.state, m.connection.output, want)
+		}
+	})
+}
+
+func TestHostKeyMismatch(t *testing.T) {
+	stderr, err := os.ReadFile("testdata/hostkey/changed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"changed", "changedDoubleQuoted"} {
+		t.Run("parse "+name, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata/hostkey", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseHostKeyMismatch(string(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := hostKeyMismatch{
+				Host:           "[web.example]:2222",
+				KeyType:        "ED25519",
+				NewFingerprint: "SHA256:n6bN8p2Vq1m0C9GmzYqH3uWbJmVx7pQ2rV0aKXcY5sE",
+				OldFingerprint: "SHA256:ZlKwYpJT0vWMFeH/Y6Yh5P3+X6sBtx27N0oLMhNCXT4",
+				File:           "testdata/hostkey/known_hosts",
+				Line:           2,
+			}
+			if got != want {
+				t.Errorf("got %+v, wanted %+v", got, want)
+			}
+		})
+	}
+	t.Run("no offending key", func(t *testing.T) {
+		if _, err := parseHostKeyMismatch("Host key verification failed.\r\n"); err == nil {
+			t.Error("got no error")
+		}
+	})
+	t.Run("confirmed key", func(t *testing.T) {
+		mismatch := hostKeyMismatch{Host: "[web.example]:2222", NewFingerprint: "SHA256:+GGrNIO2qPyQQictfWaOcMzq52RQBg8Q1XotzAQMeRg"}
+		scanned := "# web.example:2222 SSH-2.0-OpenSSH_9.6\n" +
+			"web.example ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIILdt1Q9WnIeM1S4QJZ8j5yo0cZ/0B92vD/GXAIqmG6j\n" +
+			"web.example ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJ1tIMYzkuqBU/jCggoTQUdwLuEmMSmGKcqzM69zRsoc\n"
+		want := "[web.example]:2222 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJ1tIMYzkuqBU/jCggoTQUdwLuEmMSmGKcqzM69zRsoc"
+		if got, err := confirmedKeyLine([]byte(scanned), mismatch); err != nil || got != want {
+			t.Errorf("got %q (%v), wanted %q", got, err, want)
+		}
+		mismatch.NewFingerprint = "SHA256:n6bN8p2Vq1m0C9GmzYqH3uWbJmVx7pQ2rV0aKXcY5sE"
+		if _, err := confirmedKeyLine([]byte(scanned), mismatch); err == nil {
+			t.Error("got no error for a key that wasn't confirmed")
+		}
+	})
+	t.Run("pin confirmed key", func(t *testing.T) {
+		if _, err := exec.LookPath("ssh-keygen"); err != nil {
+			t.Skip(err)
+		}
+		content, _ := os.ReadFile("testdata/hostkey/known_hosts")
+		path := filepath.Join(t.TempDir(), "known_hosts")
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		mismatch, err := parseHostKeyMismatch(strings.ReplaceAll(string(stderr), "testdata/hostkey/known_hosts", path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		line := "[web.example]:2222 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJ1tIMYzkuqBU/jCggoTQUdwLuEmMSmGKcqzM69zRsoc"
+		if err := pinHostKey(mismatch, line); err != nil {
+			t.Fatal(err)
+		}
+		content, _ = os.ReadFile(path)
+		if strings.Contains(string(content), "[web.example]:2222 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIILdt1Q9") || !strings.Contains(string(content), line) || !strings.Contains(string(content), "other.example") {
+			t.Errorf("got %q, wanted only the old key replaced", content)
+		}
+	})
+	t.Run("pin hashed key", func(t *testing.T) {
+		if _, err := exec.LookPath("ssh-keygen"); err != nil {
+			t.Skip(err)
+		}
+		hashed, err := hashKnownHost("[web.example]:2222")
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "known_hosts")
+		content := hashed + " ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIILdt1Q9WnIeM1S4QJZ8j5yo0cZ/0B92vD/GXAIqmG6j\n"
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		mismatch := hostKeyMismatch{Host: "[web.example]:2222", File: path, Line: 1}
+		if err := pinHostKey(mismatch, "[web.example]:2222 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJ1tIMYzkuqBU/jCggoTQUdwLuEmMSmGKcqzM69zRsoc"); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := os.ReadFile(path)
+		if strings.Contains(string(got), "web.example") || strings.Contains(string(got), "AAAAIILdt1Q9") {
+			t.Errorf("got %q, wanted only the new key with its host hashed", got)
+		}
+		out, err := exec.Command("ssh-keygen", "-F", "[web.example]:2222", "-f", path).Output()
+		if err != nil || !strings.Contains(string(out), "AAAAIJ1tIMYzkuqBU") {
+			t.Errorf("got %q (%v), wanted the new key found for the host", out, err)
+		}
+	})
+	t.Run("replace and retry", func(t *testing.T) {
+		i := Item{Host: "web", Hostname: "web.example", Port: "2222"}
+		m := newModel([]list.Item{i}, []list.Item{}, "", pingOpts, nil)
+		failure := newConnectFailure(i, string(stderr), 255)
+		if failure.HostKey == nil {
+			t.Fatal("got no host key mismatch")
+		}
+		m.failure = &failure
+		m.connection.state = "Failed"
+
+		updated, cmd := m.Update(tea.KeyPressMsg{Code: 'y', Text: "y"})
+		m = updated.(model)
+		if m.connection.state != "Replacing" || cmd == nil {
+			t.Fatalf("got state %q, wanted replacing the key", m.connection.state)
+		}
+
+		failed, _ := m.Update(hostKeyReplacedMsg{item: i, err: errors.New("the host no longer presents the key")})
+		if f := failed.(model); f.connection.state != "Pinged" || !strings.Contains(f.connection.output, "no longer presents") {
+			t.Errorf("got state %q with %q, wanted the error shown", f.connection.state, f.connection.output)
+		}
+
+		updated, _ = m.Update(hostKeyReplacedMsg{item: i})
+		m = updated.(model)
+		jb, ok := m.jobs.byKind(connectJob)
+		if m.connection.state != "Connecting" || m.failure != nil || !ok {
+			t.Fatalf("got state %q, wanted connecting again", m.connection.state)
+		}
+		if slices.Contains(jb.Args, "StrictHostKeyChecking=accept-new") {
+			t.Errorf("got %q, wanted the host key checked as strictly as ever", jb.Args)
+		}
+		m.jobs.cancelAll()
+	})
+}
+
+func TestInteractiveAuth(t *testing.T) {
+	cases := []struct {
+		Description string
+		Stderr      string
+		Want        bool
+	}{
+		{"password", "admin@10.0.0.1: Permission denied (publickey,password).\r\n", true},
+		{"keyboard-interactive", "admin@10.0.0.1: Permission denied (publickey,keyboard-interactive).\r\n", true},
+		{"publickey only", "admin@10.0.0.1: Permission denied (publickey).\r\n", false},
+		{"refused", "ssh: connect to host 10.0.0.1 port 22: Connection refused\r\n", false},
+	}
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			if got := needsInteractiveAuth(test.Stderr); got != test.Want {
+				t.Errorf("got %t, wanted %t", got, test.Want)
+			}
+		})
+	}
+
+	t.Run("detected once", func(t *testing.T) {
+		i := Item{Host: "mfa", Hostname: "10.0.0.1"}
+		m := newModel([]list.Item{i}, []list.Item{}, "", pingOpts, nil)
+		denied := commandResult{stderr: "admin@10.0.0.1: Permission denied (publickey,keyboard-interactive).\r\n", exitCode: 255}
+
+		cmd := m.connect(i, 0)
+		jb, _ := m.jobs.byKind(connectJob)
+		updated, _ := m.Update(connectJobMsg{id: jb.ID, commandResult: denied})
+		m = updated.(model)
+		if m.connection.state != "Authenticating" {
+			t.Fatalf("got state %q, wanted authenticating", m.connection.state)
+		}
+
+		updated, cmd = m.Update(authDoneMsg{item: i, index: 0})
+		m = updated.(model)
+		if m.connection.state != "Connecting" || cmd == nil {
+			t.Fatalf("got state %q, wanted connecting again", m.connection.state)
+		}
+
+		// Still being denied after authenticating isn't retried forever
+		jb, _ = m.jobs.byKind(connectJob)
+		updated, _ = m.Update(connectJobMsg{id: jb.ID, commandResult: denied})
+		m = updated.(model)
+		if m.connection.state != "Failed" {
+			t.Errorf("got state %q, wanted failure shown", m.connection.state)
+		}
+	})
+	t.Run("unknown host key", func(t *testing.T) {
+		i := Item{Host: "new", Hostname: "10.0.0.2"}
+		m := newModel([]list.Item{i}, []list.Item{}, "", pingOpts, nil)
+		unknown := commandResult{stderr: "No ED25519 host key is known for 10.0.0.2 and you have requested strict checking.\r\nHost key verification failed.\r\n", exitCode: 255}
+
+		m.connect(i, 0)
+		jb, _ := m.jobs.byKind(connectJob)
+		if slices.Contains(jb.Args, "BatchMode=yes") || !slices.Contains(jb.Args, "StrictHostKeyChecking=yes") {
+			t.Errorf("got %q, wanted only prompts that can't be answered turned off", jb.Args)
+		}
+		updated, _ := m.Update(connectJobMsg{id: jb.ID, commandResult: unknown})
+		if m = updated.(model); m.connection.state != "Authenticating" {
+			t.Errorf("got state %q, wanted the terminal handed over for confirming the key", m.connection.state)
+		}
+	})
+	t.Run("configured host key checking", func(t *testing.T) {
+		i := Item{Host: "lab", Hostname: "10.0.0.3", Options: []sshOption{{Keyword: "stricthostkeychecking", Args: []string{"accept-new"}}}}
+		if opts := backgroundOpts(i); slices.ContainsFunc(opts, func(o string) bool { return strings.HasPrefix(o, "StrictHostKeyChecking") }) {
+			t.Errorf("got %q, wanted the configured host key checking kept", opts)
+		}
+	})
+	t.Run("marked", func(t *testing.T) {
+		i := Item{Host: "mfa.example", Hostname: "10.0.0.1"}
+		m := newModel([]list.Item{i}, []list.Item{}, "", pingOpts, nil)
+		m.interactiveHosts = "*.example"
+		updated, _ := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+		if m = updated.(model); m.connection.state != "Authenticating" || len(m.jobs.jobs) != 0 {
+			t.Errorf("got state %q and %d jobs, wanted authenticating first", m.connection.state, len(m.jobs.jobs))
+		}
+	})
+}
+
+func TestConnectPhases(t *testing.T) {
+	content, err := os.ReadFile("testdata/ssh/verbose")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := newPhaseTracker(start)
+	var got []connectPhase
+	for n, line := range strings.Split(strings.TrimRight(string(content), "\r\n"), "\n") {
+		// Every line is logged 10 milliseconds after the one before it
+		if phase, ok := tracker.observe(line, start.Add(time.Duration(n+1)*10*time.Millisecond)); ok {
+			got = append(got, phase)
+		}
+	}
+
+	want := []connectPhase{
+		{Name: "DNS", Detail: "10.0.0.5", Duration: 30 * time.Millisecond},
+		{Name: "TCP connect", Duration: 10 * time.Millisecond},
+		{Name: "key exchange", Detail: "ssh-ed25519", Duration: 40 * time.Millisecond},
+		{Name: "host key", Detail: "/home/user/.ssh/known_hosts:2", Duration: 20 * time.Millisecond},
+		{Name: "auth", Detail: "password after trying publickey, password", Duration: 70 * time.Millisecond},
+		{Name: "session", Duration: 10 * time.Millisecond},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, wanted %+v", got, want)
+	}
+	if !reflect.DeepEqual(tracker.phases, want) {
+		t.Errorf("got tracked %+v, wanted %+v", tracker.phases, want)
+	}
+
+	wantStderr := []string{"Warning: Permanently added the ED25519 host key for IP address '10.0.0.5' to the list of known hosts."}
+	if !reflect.DeepEqual(tracker.stderr, wantStderr) {
+		t.Errorf("got standard error %q, wanted %q", tracker.stderr, wantStderr)
+	}
+
+	t.Run("exit code", func(t *testing.T) {
+		i := Item{Host: "web", Hostname: "10.0.0.5"}
+		m := newModel([]list.Item{i}, []list.Item{}, "", pingOpts, nil)
+		m.connect(i, 0)
+		jb, _ := m.jobs.byKind(connectJob)
+		updated, _ := m.Update(connectPhaseMsg{id: jb.ID, phase: want[0]})
+		if m = updated.(model); len(m.connection.phases) != 1 {
+			t.Fatalf("got %d phases while connecting, wanted 1", len(m.connection.phases))
+		}
+
+		// Warnings on a connection that went through don't make it fail
+		result := commandResult{output: []string{"up"}, stderr: wantStderr[0], exitCode: 0}
+		updated, _ = m.Update(connectJobMsg{id: jb.ID, commandResult: result, phases: want})
+		if m = updated.(model); m.connection.state != "Connected" || len(m.connection.phases) != len(want) {
+			t.Errorf("got state %q with %d phases, wanted connected with %d", m.connection.state, len(m.connection.phases), len(want))
+		}
+	})
+}
+
+func TestControlMasters(t *testing.T) {
+	cases := []struct {
+		Description string
+		Name        string
+		Want        []string
+	}{
+		{"host", "control:web.example:22:deploy", []string{"web.example", "22", "deploy"}},
+		{"ipv6", "control:fd00::5:2222:root", []string{"fd00::5", "2222", "root"}},
+		{"no user", "control:web.example:22:", []string{"web.example", "22", ""}},
+		{"other socket", "agent.1234", nil},
+		{"incomplete", "control:web.example", nil},
+	}
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			host, port, user, ok := parseControlSocketName(test.Name)
+			var got []string
+			if ok {
+				got = []string{host, port, user}
+			}
+			if !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("got %q, wanted %q", got, test.Want)
+			}
+		})
+	}
+
+	t.Run("listed", func(t *testing.T) {
+		dir := t.TempDir()
+		for _, name := range []string{"control:web.example:22:deploy", "control:db.example:2222:admin"} {
+			l, err := net.Listen("unix", filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+		}
+		// Only sockets are control sockets
+		if err := os.WriteFile(filepath.Join(dir, "control:notes:22:x"), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-time.Hour)
+		os.Chtimes(filepath.Join(dir, "control:web.example:22:deploy"), old, old)
+
+		masters, err := listControlSockets(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, c := range masters {
+			got = append(got, c.Host)
+		}
+		if want := []string{"web.example", "db.example"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %q, wanted %q oldest first", got, want)
+		}
+	})
+	t.Run("marked", func(t *testing.T) {
+		masters := []controlMaster{
+			{Host: "10.0.0.5", Port: "22", User: "deploy", Running: true},
+			{Host: "10.0.0.6", Port: "22", User: "deploy"},
+			{Host: "10.0.0.7", Port: "2222", User: "admin", Running: true},
+		}
+		items := []list.Item{
+			Item{Host: "web", Hostname: "10.0.0.5"},
+			Item{Host: "stopped", Hostname: "10.0.0.6"},
+			Item{Host: "db", Hostname: "10.0.0.7", Port: "2222", User: "admin"},
+			Item{Host: "other user", Hostname: "10.0.0.7", Port: "2222", User: "root"},
+			Item{Host: "other port", Hostname: "10.0.0.7"},
+			Item{Host: "10.0.0.5", Hostname: "web01", User: "deploy", Origins: []itemOrigin{{Source: inventorySource}}},
+		}
+		var got []bool
+		for _, li := range markMasters(items, masters) {
+			got = append(got, li.(Item).Master)
+		}
+		if want := []bool{true, false, true, false, false, true}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, wanted %v", got, want)
+		}
+	})
+	t.Run("checked", func(t *testing.T) {
+		if _, err := exec.LookPath(sshExecutableName); err != nil {
+			t.Skip("no ssh to check with")
+		}
+		// Something other than SSH listening isn't a running master
+		path := filepath.Join(t.TempDir(), "control:web.example:22:deploy")
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		go func() {
+			if conn, err := l.Accept(); err == nil {
+				conn.Close()
+			}
+		}()
+		c := controlMaster{Path: path, Host: "web.example"}
+		c.check(context.Background())
+		if c.Running || c.Status == "" {
+			t.Errorf("got running %t with status %q, wanted not running", c.Running, c.Status)
+		}
+	})
+}
+
+func TestControlDir(t *testing.T) {
+	t.Run("created", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "wishlistlite")
+		if err := prepareControlDir(dir); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0o700 {
+			t.Errorf("got mode %v, wanted 0700", info.Mode().Perm())
+		}
+		// Preparing it again leaves it as it is
+		if err := prepareControlDir(dir); err != nil {
+			t.Errorf("got %v, wanted it used again", err)
+		}
+	})
+	t.Run("refused", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("no permission bits to check")
+		}
+		parent := t.TempDir()
+		writable := filepath.Join(parent, "writable")
+		os.Mkdir(writable, 0o700)
+		os.Chmod(writable, 0o777)
+		if err := prepareControlDir(writable); !errors.Is(err, errWorldWritable) {
+			t.Errorf("got %v, wanted world-writable directory refused", err)
+		}
+
+		open := filepath.Join(parent, "open")
+		os.Mkdir(open, 0o700)
+		os.Chmod(open, 0o777)
+		if err := prepareControlDir(filepath.Join(open, "wishlistlite")); err == nil {
+			t.Error("got directory in world-writable directory used")
+		}
+		os.Chmod(open, 0o777|os.ModeSticky)
+		if err := prepareControlDir(filepath.Join(open, "sticky")); err != nil {
+			t.Errorf("got %v, wanted directory in sticky directory used", err)
+		}
+
+		link := filepath.Join(parent, "link")
+		os.Symlink(filepath.Join(open, "sticky"), link)
+		if err := prepareControlDir(link); err == nil {
+			t.Error("got symbolic link used")
+		}
+	})
+	t.Run("persist", func(t *testing.T) {
+		control := controlOptions{Dir: "/run/user/1000/wishlistlite", Persist: "5s"}
+		cases := []struct {
+			Description string
+			Options     []sshOption
+			Want        string
+		}{
+			{"default", nil, "ControlPersist=5s"},
+			{"configured", []sshOption{{Keyword: "controlpersist", Args: []string{"10m"}}}, "ControlPersist=10m"},
+			{"forever", []sshOption{{Keyword: "controlpersist", Args: []string{"yes"}}}, "ControlPersist=yes"},
+			{"not persisted", []sshOption{{Keyword: "controlpersist", Args: []string{"no"}}}, "ControlPersist=5s"},
+		}
+		for _, test := range cases {
+			t.Run(test.Description, func(t *testing.T) {
+				got := control.parentOpts(Item{Host: "web", Options: test.Options})
+				want := []string{"-T", "-o", "ControlMaster=auto", "-o", test.Want, "-o", "ControlPath=/run/user/1000/wishlistlite/control:%h:%p:%r"}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("got %q, wanted %q", got, want)
+				}
+			})
+		}
+	})
+	t.Run("stale", func(t *testing.T) {
+		dir := t.TempDir()
+		stale := filepath.Join(dir, "control:web.example:22:deploy")
+		l, err := net.Listen("unix", stale)
+		if err != nil {
+			t.Skip(err)
+		}
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		l.Close()
+		live, err := net.Listen("unix", filepath.Join(dir, "control:db.example:22:deploy"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer live.Close()
+
+		if got := cleanStaleSockets(dir); got != 1 {
+			t.Errorf("got %d removed, wanted 1", got)
+		}
+		if _, err := os.Stat(stale); !errors.Is(err, os.ErrNotExist) {
+			t.Error("got stale socket kept")
+		}
+	})
+}
+
+func TestLoop(t *testing.T) {
+	t.Run("session", func(t *testing.T) {
+		if _, err := exec.LookPath("sh"); err != nil {
+			t.Skip("no shell to run a session with")
+		}
+		var out strings.Builder
+		s := &sessionExec{cmd: exec.Command("sh", "-c", "echo in session; exit 3"), header: "Connected in 1s\n"}
+		s.SetStdout(&out)
+		if err := s.Run(); err != nil {
+			t.Fatalf("got %v, wanted exit code kept as the result", err)
+		}
+		if s.result.ExitCode != 3 {
+			t.Errorf("got exit code %d, wanted 3", s.result.ExitCode)
+		}
+		if got, want := out.String(), "Connected in 1s\nin session\n"; got != want {
+			t.Errorf("got %q, wanted %q", got, want)
+		}
+	})
+	t.Run("back to the list", func(t *testing.T) {
+		items := []list.Item{Item{Host: "web", Hostname: "10.0.0.5"}, Item{Host: "db", Hostname: "10.0.0.6"}}
+		m := newModel(items, []list.Item{}, filepath.Join(t.TempDir(), "recent.json"), pingOpts, nil)
+		m.loop = true
+		m.list.Select(1)
+
+		m.connect(items[1].(Item), 1)
+		jb, _ := m.jobs.byKind(connectJob)
+		updated, cmd := m.Update(connectJobMsg{id: jb.ID, commandResult: commandResult{output: []string{""}}})
+		m = updated.(model)
+		if m.connection.state != "Session" || m.quitting || cmd == nil {
+			t.Fatalf("got state %q, wanted session started without quitting", m.connection.state)
+		}
+
+		result := sessionResult{ExitCode: 130, Duration: 90 * time.Second}
+		updated, _ = m.Update(sessionDoneMsg{item: items[1].(Item), result: result})
+		m = updated.(model)
+		if m.connection.state != "Pinged" || m.choice != "" {
+			t.Errorf("got state %q with choice %q, wanted the list back", m.connection.state, m.choice)
+		}
+		if got := m.list.SelectedItem().(Item); got.Host != "db" || got.Session == nil || *got.Session != result {
+			t.Errorf("got %q with session %v selected, wanted db with %v", got.Host, got.Session, result)
+		}
+		if got, want := m.connection.output, `"db" session exited 130 after 1m30s`; got != want {
+			t.Errorf("got %q, wanted %q", got, want)
+		}
+	})
+}
+
+func TestTmux(t *testing.T) {
+	sshArgs := []string{"web", "-S", "/run/user/1000/wishlistlite/control:%h:%p:%r"}
+	cases := []struct {
+		Description string
+		Where       string
+		Want        []string
+	}{
+		{"window", tmuxWindow, []string{"new-window", "-n", "web", "ssh", "web", "-S", "/run/user/1000/wishlistlite/control:%h:%p:%r"}},
+		{"split", tmuxSplit, []string{"split-window", "-h", "ssh", "web", "-S", "/run/user/1000/wishlistlite/control:%h:%p:%r", ";", "select-pane", "-T", "web"}},
+	}
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			if got := tmuxArgs(test.Where, "web", sshArgs); !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("got %q, wanted %q", got, test.Want)
+			}
+		})
+	}
+
+	t.Run("picker stays open", func(t *testing.T) {
+		i := Item{Host: "web", Hostname: "10.0.0.5"}
+		recent := filepath.Join(t.TempDir(), "recent.json")
+		m := newModel([]list.Item{i}, []list.Item{}, recent, pingOpts, nil)
+		updated, _ := m.Update(tea.KeyPressMsg{Code: 'T', Text: "T"})
+		m = updated.(model)
+		jb, ok := m.jobs.byKind(connectJob)
+		if !ok || m.launchWith != (tmuxLauncher{where: tmuxSplit}) {
+			t.Fatalf("got launching with %v, wanted connecting for a split", m.launchWith)
+		}
+
+		updated, cmd := m.Update(connectJobMsg{id: jb.ID, commandResult: commandResult{output: []string{""}}})
+		m = updated.(model)
+		if m.quitting || m.choice != "" || cmd == nil {
+			t.Errorf("got quitting %t with choice %q, wanted the picker kept open", m.quitting, m.choice)
+		}
+		if items, err := itemsFromJson(recent); err != nil || len(items) != 1 {
+			t.Errorf("got %d recently used hosts (%v), wanted the host remembered", len(items), err)
+		}
+
+		updated, _ = m.Update(launchedMsg{item: i, where: "tmux split"})
+		if m = updated.(model); m.connection.state != "Pinged" || !strings.Contains(m.connection.output, "opened in tmux split") {
+			t.Errorf("got state %q with %q, wanted the split reported", m.connection.state, m.connection.output)
+		}
+	})
+}
+
+func TestLaunchers(t *testing.T) {
+	i := Item{Host: "web", Hostname: "10.0.0.5"}
+	sshArgs := []string{"web", "-S", "/run/user/1000/wishlistlite/control:%h:%p:%r"}
+	template, err := newLauncher("alacritty --title 'ssh {name}' -e ssh {host}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded, err := newLauncher(`xterm -T {name} -e sh -c "ssh {host}; read"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		Description string
+		Launcher    Launcher
+		Want        []string
+	}{
+		{"tmux", launchers["tmux"], []string{"tmux", "new-window", "-n", "web", "ssh", "web", "-S", "/run/user/1000/wishlistlite/control:%h:%p:%r"}},
+		{"kitty", launchers["kitty"], []string{"kitty", "@", "launch", "--type=tab", "--title", "web", "--tab-title", "web", "ssh", "web", "-S", "/run/user/1000/wishlistlite/control:%h:%p:%r"}},
+		{"kitty window", launchers["kitty-window"], []string{"kitty", "@", "launch", "--type=os-window", "--title", "web", "ssh", "web", "-S", "/run/user/1000/wishlistlite/control:%h:%p:%r"}},
+		{"wezterm", launchers["wezterm"], []string{"wezterm", "cli", "spawn", "--", "ssh", "web", "-S", "/run/user/1000/wishlistlite/control:%h:%p:%r"}},
+		{"wezterm window", launchers["wezterm-window"], []string{"wezterm", "cli", "spawn", "--new-window", "--", "ssh", "web", "-S", "/run/user/1000/wishlistlite/control:%h:%p:%r"}},
+		{"template", template, []string{"alacritty", "--title", "ssh web", "-e", "ssh", "web", "-S", "/run/user/1000/wishlistlite/control:%h:%p:%r"}},
+		{"embedded template", embedded, []string{"xterm", "-T", "web", "-e", "sh", "-c", "ssh web -S /run/user/1000/wishlistlite/control:%h:%p:%r; read"}},
+	}
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			if got := test.Launcher.Args(i, sshArgs); !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("got %q, wanted %q", got, test.Want)
+			}
+		})
+	}
+
+	t.Run("shell quoting", func(t *testing.T) {
+		got := shellJoin([]string{"-o", "ProxyCommand=nc %h %p", "it's"})
+		if want := `-o 'ProxyCommand=nc %h %p' 'it'\''s'`; got != want {
+			t.Errorf("got %s, wanted %s", got, want)
+		}
+	})
+	t.Run("chosen", func(t *testing.T) {
+		cases := []struct {
+			Description string
+			Name        string
+			Want        Launcher
+			WantErr     bool
+		}{
+			{"default", "", nil, false},
+			{"exec", "exec", nil, false},
+			{"registered", "tmux-split", tmuxLauncher{where: tmuxSplit}, false},
+			{"unknown", "xterm", nil, true},
+			{"no command", "{host}", nil, true},
+			{"unterminated quote", "xterm -T '{name} -e ssh {host}", nil, true},
+		}
+		for _, test := range cases {
+			t.Run(test.Description, func(t *testing.T) {
+				got, err := newLauncher(test.Name)
+				if (err != nil) != test.WantErr || got != test.Want {
+					t.Errorf("got %v (%v), wanted %v", got, err, test.Want)
+				}
+			})
+		}
+	})
+	t.Run("failed", func(t *testing.T) {
+		if _, err := exec.LookPath("sh"); err != nil {
+			t.Skip("no shell to launch with")
+		}
+		l, _ := newLauncher("sh -c 'echo no terminal for {name} >&2; exit 1'")
+		msg := launchCommand(i, l, sshArgs)().(launchedMsg)
+		if msg.err == nil || !strings.Contains(msg.err.Error(), "no terminal for web") {
+			t.Errorf("got %v, wanted what the launcher said", msg.err)
+		}
+	})
+}
+
+func TestConfig(t *testing.T) {
+	newFlags := func() (*flag.FlagSet, *string, *bool, *sourceFlag, *int) {
+		fs := flag.NewFlagSet("wishlistlite", flag.ContinueOnError)
+		launcher := fs.String("launcher", execLauncher, "")
+		sweep := fs.Bool("sweep", false, "")
+		var specs sourceFlag
+		fs.Var(&specs, "source", "")
+		pingCount := fs.Int("pingcount", defaultPingCount, "")
+		return fs, launcher, sweep, &specs, pingCount
+	}
+
+	fs, launcher, sweep, specs, pingCount := newFlags()
+	fs.Parse([]string{"-pingcount", "6"})
+	if err := readConfig(fs, "testdata/config/config", true); err != nil {
+		t.Fatal(err)
+	}
+	if *launcher != "alacritty -e ssh {host}" || !*sweep || len(*specs) != 2 {
+		t.Errorf("got launcher %q, sweep %t, and %d sources, wanted those from the file", *launcher, *sweep, len(*specs))
+	}
+	if *pingCount != 6 {
+		t.Errorf("got ping count %d, wanted the one given on the command line", *pingCount)
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		fs, _, _, _, _ := newFlags()
+		missing := filepath.Join(t.TempDir(), "config")
+		if err := readConfig(fs, missing, false); err != nil {
+			t.Errorf("got %v, wanted the default file to be optional", err)
+		}
+		if err := readConfig(fs, missing, true); err == nil {
+			t.Error("got no error for a file that was given")
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		cases := []struct {
+			Description string
+			Content     string
+			Want        string
+		}{
+			{"unknown", "launcher = kitty\nlauncer = tmux\n", ":2: unknown setting 'launcer'"},
+			{"no value", "sweep\n", ":1: expected 'name = value'"},
+			{"bad value", "pingcount = many\n", ":1: invalid value for 'pingcount'"},
+		}
+		for _, test := range cases {
+			t.Run(test.Description, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "config")
+				os.WriteFile(path, []byte(test.Content), 0o600)
+				fs, _, _, _, _ := newFlags()
+				if err := readConfig(fs, path, true); err == nil || !strings.Contains(err.Error(), test.Want) {
+					t.Errorf("got %v, wanted %q", err, test.Want)
+				}
+			})
+		}
 	})
 }
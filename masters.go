@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"charm.land/bubbles/v2/list"
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+)
+
+// controlSocketPrefix is what the name of every control socket made by
+// connecting starts with, followed by the host, port, and user.
+const controlSocketPrefix = "control:"
+
+// masterCheckTimeout is how long checking a single control master may take.
+const masterCheckTimeout = 5 * time.Second
+
+var (
+	mastersPanelStyle    = livePanelStyle.BorderForeground(nordAuroraGreen)
+	mastersTitleStyle    = lipgloss.NewStyle().Foreground(nordAuroraGreen)
+	mastersSelectedStyle = lipgloss.NewStyle().Foreground(nordAuroraGreen)
+)
+
+// masterPidPattern matches what 'ssh -O check' says about a master that is
+// running, e.g. 'Master running (pid=12345)'.
+var masterPidPattern = regexp.MustCompile(`Master running \(pid=(\d+)\)`)
+
+// A controlMaster is a control socket left by connecting along with what
+// checking its master said. The host, port, and user are those the socket
+// is named after.
+type controlMaster struct {
+	Path    string
+	Host    string
+	Port    string
+	User    string
+	Created time.Time
+	Running bool
+	Pid     int
+	// Status is what SSH said when checking the master
+	Status string
+}
+
+// parseControlSocketName returns the host, port, and user of the control
+// socket called 'name', which is in the form 'control:%h:%p:%r'. Hosts
+// given as IPv6 addresses contain colons themselves, so the port and user
+// are taken from the end.
+func parseControlSocketName(name string) (host, port, user string, ok bool) {
+	rest, found := strings.CutPrefix(name, controlSocketPrefix)
+	if !found {
+		return "", "", "", false
+	}
+	parts := strings.Split(rest, ":")
+	if len(parts) < 3 {
+		return "", "", "", false
+	}
+	n := len(parts)
+	host, port, user = strings.Join(parts[:n-2], ":"), parts[n-2], parts[n-1]
+	if host == "" || port == "" {
+		return "", "", "", false
+	}
+	return host, port, user, true
+}
+
+// listControlSockets returns every control socket made by connecting that
+// is in 'dir', oldest first. Files that aren't sockets are left out.
+func listControlSockets(dir string) ([]controlMaster, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, controlSocketPrefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+	var masters []controlMaster
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil || info.Mode()&os.ModeSocket == 0 {
+			continue
+		}
+		host, port, user, ok := parseControlSocketName(filepath.Base(path))
+		if !ok {
+			continue
+		}
+		masters = append(masters, controlMaster{Path: path, Host: host, Port: port, User: user, Created: info.ModTime()})
+	}
+	// Globbing sorts by name, but the age is what's shown
+	slices.SortStableFunc(masters, func(a, b controlMaster) int { return a.Created.Compare(b.Created) })
+	return masters, nil
+}
+
+// check asks the master of the control socket with 'ssh -O check' whether
+// it's running and records what it said.
+func (c *controlMaster) check(ctx context.Context) {
+	out, err := exec.CommandContext(ctx, sshExecutableName, c.controlArgs("check")...).CombinedOutput()
+	c.Status = strings.TrimSpace(strings.ReplaceAll(string(out), "\r\n", "\n"))
+	c.Running = err == nil
+	if m := masterPidPattern.FindStringSubmatch(c.Status); m != nil {
+		c.Pid, _ = strconv.Atoi(m[1])
+	}
+	if c.Status == "" && err != nil {
+		c.Status = err.Error()
+	}
+}
+
+// controlArgs returns the arguments given to SSH for sending the control
+// command 'op' to the master. The socket is given explicitly, so the host
+// is only there as SSH requires one.
+func (c controlMaster) controlArgs(op string) []string {
+	return []string{"-O", op, "-S", c.Path, c.Host}
+}
+
+// matches reports whether the master is the one connecting to 'i' would
+// reuse. Items that don't say which user or port they connect as are
+// assumed to be using the defaults.
+func (c controlMaster) matches(i Item) bool {
+	hostname := i.connectHost()
+	if hostname == "" {
+		hostname = i.Host
+	}
+	port := i.Port
+	if port == "" {
+		port = "22"
+	}
+	return strings.EqualFold(c.Host, hostname) && c.Port == port && (i.User == "" || c.User == i.User)
+}
+
+// String returns the master in the form shown in the list of masters.
+func (c controlMaster) String() string {
+	destination := net.JoinHostPort(c.Host, c.Port)
+	if c.User != "" {
+		destination = fmt.Sprintf("%s@%s", c.User, destination)
+	}
+	state := downStyle.Render("● not running")
+	if c.Running {
+		state = upStyle.Render("● running")
+		if c.Pid > 0 {
+			state = upStyle.Render(fmt.Sprintf("● running (pid %d)", c.Pid))
+		}
+	}
+	return fmt.Sprintf("%s %s (%v old)", destination, state, time.Since(c.Created).Round(time.Second))
+}
+
+// A mastersMsg carries every control master that was found, or the error
+// that prevented looking for them.
+type mastersMsg struct {
+	masters []controlMaster
+	err     error
+}
+
+// listMastersCommand returns a command that lists the control sockets in
+// 'dir' and checks each of their masters at the same time.
+func listMastersCommand(dir string) tea.Cmd {
+	return func() tea.Msg {
+		masters, err := listControlSockets(dir)
+		if err != nil {
+			return mastersMsg{err: err}
+		}
+		var wg sync.WaitGroup
+		for n := range masters {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), masterCheckTimeout)
+				defer cancel()
+				masters[n].check(ctx)
+			}()
+		}
+		wg.Wait()
+		return mastersMsg{masters: masters}
+	}
+}
+
+// A masterControlMsg indicates that the control command 'op' was sent to
+// 'master', or the error that prevented it.
+type masterControlMsg struct {
+	master controlMaster
+	op     string
+	err    error
+}
+
+// masterControlCommand returns a command that sends the control command
+// 'op' to 'master', where 'stop' makes it stop accepting new connections
+// and 'exit' makes it exit right away along with every connection.
+func masterControlCommand(master controlMaster, op string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), masterCheckTimeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, sshExecutableName, master.controlArgs(op)...).CombinedOutput()
+		if err != nil {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+		}
+		return masterControlMsg{master: master, op: op, err: err}
+	}
+}
+
+// markMasters returns 'items' with every one that has a running master
+// marked as such, and any others unmarked.
+func markMasters(items []list.Item, masters []controlMaster) []list.Item {
+	marked := make([]list.Item, len(items))
+	for n, li := range items {
+		i := li.(Item)
+		i.Master = false
+		for _, c := range masters {
+			if c.Running && c.matches(i) {
+				i.Master = true
+				break
+			}
+		}
+		marked[n] = i
+	}
+	return marked
+}
+
+// mastersView returns the panel listing every control master with the
+// one at 'cursor' highlighted.
+func mastersView(masters []controlMaster, cursor int) string {
+	lines := []string{mastersTitleStyle.Render(fmt.Sprintf("Control masters (%d)", len(masters))), ""}
+	if len(masters) == 0 {
+		lines = append(lines, unknownStyle.Render("No control sockets found"))
+	}
+	for n, c := range masters {
+		line := fmt.Sprintf("  %s", c)
+		if n == cursor {
+			line = mastersSelectedStyle.Render("> ") + line[2:]
+		}
+		lines = append(lines, line)
+	}
+	if cursor < len(masters) && !masters[cursor].Running && masters[cursor].Status != "" {
+		lines = append(lines, "", unknownStyle.Render(masters[cursor].Status))
+	}
+	lines = append(lines, "", versionStyle("↑/↓ choose • s stop • x exit • r refresh • esc back"))
+	return mastersPanelStyle.Render(strings.Join(lines, "\n"))
+}
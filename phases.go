@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+)
+
+// sshVerboseOpts make SSH log what it's doing while connecting. Unlike '-v'
+// this keeps a control master that goes to the background from holding on
+// to the standard error of the connection.
+var sshVerboseOpts = []string{"-o", "LogLevel=DEBUG1"}
+
+// sshFailedExitCode is what SSH exits with when it fails on its own, as any
+// other exit code comes from the remote command.
+const sshFailedExitCode = 255
+
+// connectPhasePatterns match the lines SSH logs when a phase of connecting
+// is done, in the order the phases happen in. The first group, if any, is
+// shown alongside the phase.
+var connectPhasePatterns = []struct {
+	Name    string
+	Pattern *regexp.Regexp
+}{
+	{"DNS", regexp.MustCompile(`Connecting to \S+ \[([^\]]+)\] port`)},
+	{"TCP connect", regexp.MustCompile(`Connection established`)},
+	{"key exchange", regexp.MustCompile(`Server host key: (\S+)`)},
+	{"host key", regexp.MustCompile(`Found key in (\S+)`)},
+	{"auth", regexp.MustCompile(`Authenticated to .* using "([^"]+)"|Authentication succeeded \(([^)]+)\)`)},
+	{"reused master", regexp.MustCompile(`mux_client_request_session: master session id`)},
+	{"session", regexp.MustCompile(`Entering interactive session`)},
+}
+
+// authMethodPattern matches the lines SSH logs when trying a method of
+// authentication.
+var authMethodPattern = regexp.MustCompile(`Next authentication method: (\S+)`)
+
+// A connectPhase is a part of connecting that is done, along with how long
+// it took since the one before it.
+type connectPhase struct {
+	Name     string
+	Detail   string
+	Duration time.Duration
+}
+
+// String returns the phase in the form shown after connecting.
+func (p connectPhase) String() string {
+	return fmt.Sprintf("%s %v", p.Name, p.Duration.Round(time.Millisecond))
+}
+
+// phasesView returns the phases of connecting that are done in the form
+// shown while connecting, one per line.
+func phasesView(phases []connectPhase) string {
+	var b strings.Builder
+	for _, p := range phases {
+		line := fmt.Sprintf("%s %-14s %8v", upStyle.Render("✓"), p.Name, p.Duration.Round(time.Millisecond))
+		if p.Detail != "" {
+			line = fmt.Sprintf("%s  %s", line, versionStyle(p.Detail))
+		}
+		fmt.Fprintf(&b, "   %s\n", line)
+	}
+	if len(phases) > 0 {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// A phaseTracker follows the lines SSH logs while connecting and keeps
+// track of which phases are done.
+type phaseTracker struct {
+	last    time.Time
+	phases  []connectPhase
+	methods []string
+	// stderr is everything logged that isn't a debugging message
+	stderr []string
+}
+
+// newPhaseTracker returns a tracker where the first phase started at
+// 'start'.
+func newPhaseTracker(start time.Time) *phaseTracker {
+	return &phaseTracker{last: start}
+}
+
+// observe looks at 'line' logged at 'at' and returns the phase it finished,
+// if any. Each phase is only finished once.
+func (t *phaseTracker) observe(line string, at time.Time) (connectPhase, bool) {
+	line = strings.TrimRight(line, "\r")
+	if m := authMethodPattern.FindStringSubmatch(line); m != nil {
+		t.methods = append(t.methods, m[1])
+		return connectPhase{}, false
+	}
+
+	// Some phases are logged without being marked as debugging messages
+	for _, p := range connectPhasePatterns {
+		m := p.Pattern.FindStringSubmatch(line)
+		if m == nil || t.done(p.Name) {
+			continue
+		}
+		phase := connectPhase{Name: p.Name, Detail: strings.Join(m[1:], ""), Duration: at.Sub(t.last)}
+		if p.Name == "auth" && len(t.methods) > 1 {
+			phase.Detail = fmt.Sprintf("%s after trying %s", phase.Detail, strings.Join(t.methods, ", "))
+		}
+		t.last = at
+		t.phases = append(t.phases, phase)
+		return phase, true
+	}
+	if !isDebugLine(line) {
+		t.stderr = append(t.stderr, line)
+	}
+	return connectPhase{}, false
+}
+
+// done reports whether the phase called 'name' is done.
+func (t *phaseTracker) done(name string) bool {
+	for _, p := range t.phases {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isDebugLine reports whether 'line' is a debugging message logged by SSH.
+func isDebugLine(line string) bool {
+	return strings.HasPrefix(line, "debug1: ") || strings.HasPrefix(line, "debug2: ") || strings.HasPrefix(line, "debug3: ")
+}
+
+// A connectPhaseMsg carries a phase of connecting done by the job with the
+// given ID.
+type connectPhaseMsg struct {
+	id     int
+	phase  connectPhase
+	phases <-chan connectPhaseMsg
+}
+
+// waitForConnectPhase returns a command that waits for the next phase of
+// connecting on 'phases'.
+func waitForConnectPhase(phases <-chan connectPhaseMsg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-phases
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// runConnect runs SSH with 'args' along with verbose logging and sends each
+// phase of connecting to 'phases' as it's done, which is closed once SSH is.
+// The lines of its standard output are returned along with whatever else
+// it logged and its exit code, as well as every phase.
+func runConnect(ctx context.Context, id int, args []string, phases chan connectPhaseMsg) (commandResult, []connectPhase) {
+	defer close(phases)
+
+	var stdout bytes.Buffer
+	pr, pw := io.Pipe()
+	c := exec.CommandContext(ctx, sshExecutableName, slices.Concat(sshVerboseOpts, args)...)
+	c.Stdout, c.Stderr = &stdout, pw
+	// Anything that went to the background must not keep this waiting
+	c.WaitDelay = time.Second
+
+	tracker := newPhaseTracker(time.Now())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			phase, ok := tracker.observe(scanner.Text(), time.Now())
+			if !ok {
+				continue
+			}
+			select {
+			case phases <- connectPhaseMsg{id: id, phase: phase, phases: phases}:
+			case <-ctx.Done():
+			}
+		}
+		io.Copy(io.Discard, pr)
+	}()
+
+	err := c.Run()
+	pw.Close()
+	<-done
+
+	result := commandResult{stderr: strings.Join(tracker.stderr, "\n"), exitCode: -1}
+	if c.ProcessState != nil {
+		result.exitCode = c.ProcessState.ExitCode()
+	} else if err != nil {
+		result.stderr = err.Error()
+	}
+	if result.exitCode != sshFailedExitCode && result.exitCode >= 0 {
+		result.output = strings.Split(strings.TrimRight(stdout.String(), "\n"), "\n")
+	}
+	return result, tracker.phases
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Patterns matching the lines of 'ping' output that are parsed. Linux
+// (iputils), BSD, macOS, and BusyBox all word these slightly differently.
+var (
+	pingReplyPattern = regexp.MustCompile(`(?:icmp_)?seq=\d+ .*time[=<]([\d.]+) ?ms`)
+	pingCountPattern = regexp.MustCompile(`(\d+) packets transmitted, (\d+) (?:packets )?received`)
+	pingLossPattern  = regexp.MustCompile(`([\d.]+)% packet loss`)
+	pingRttPattern   = regexp.MustCompile(`(?:rtt|round-trip) min/avg/max(?:/(?:mdev|stddev))? = ([\d.]+)/([\d.]+)/([\d.]+)(?:/([\d.]+))? ms`)
+)
+
+// sparklineBlocks are the characters a sparkline is drawn with, from the
+// lowest value to the highest.
+var sparklineBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// A pingResult is the outcome of pinging a host: how many packets made it
+// back, the round-trip time statistics, and the round-trip time of each
+// reply in the order they were received.
+type pingResult struct {
+	Transmitted int
+	Received    int
+	Loss        float64
+	Min         time.Duration
+	Avg         time.Duration
+	Max         time.Duration
+	Mdev        time.Duration
+	Samples     []time.Duration
+}
+
+// parsePingOutput returns a 'pingResult' from the lines 'ping' wrote to its
+// standard output. An error is returned when the output doesn't contain the
+// statistics 'ping' prints when it's done.
+func parsePingOutput(lines []string) (pingResult, error) {
+	var (
+		result pingResult
+		found  bool
+	)
+	for _, line := range lines {
+		if m := pingReplyPattern.FindStringSubmatch(line); m != nil {
+			result.Samples = append(result.Samples, parseMilliseconds(m[1]))
+			continue
+		}
+		if m := pingCountPattern.FindStringSubmatch(line); m != nil {
+			found = true
+			result.Transmitted, _ = strconv.Atoi(m[1])
+			result.Received, _ = strconv.Atoi(m[2])
+			if l := pingLossPattern.FindStringSubmatch(line); l != nil {
+				result.Loss, _ = strconv.ParseFloat(l[1], 64)
+			}
+			continue
+		}
+		if m := pingRttPattern.FindStringSubmatch(line); m != nil {
+			result.Min = parseMilliseconds(m[1])
+			result.Avg = parseMilliseconds(m[2])
+			result.Max = parseMilliseconds(m[3])
+			result.Mdev = parseMilliseconds(m[4])
+		}
+	}
+
+	if !found {
+		return pingResult{}, errors.New("no ping statistics found")
+	}
+	return result, nil
+}
+
+// parseMilliseconds returns the number of milliseconds in 's' as a duration,
+// or zero if 's' isn't a number.
+func parseMilliseconds(s string) time.Duration {
+	ms, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// String returns the result in the form shown in the status bar.
+func (r pingResult) String() string {
+	s := fmt.Sprintf("%d/%d received, %g%% loss", r.Received, r.Transmitted, r.Loss)
+	if r.Received == 0 {
+		return s
+	}
+	s = fmt.Sprintf("%s, rtt min/avg/max/mdev %v/%v/%v/%v", s, roundRtt(r.Min), roundRtt(r.Avg), roundRtt(r.Max), roundRtt(r.Mdev))
+	if len(r.Samples) > 1 {
+		s = fmt.Sprintf("%s %s", s, sparkline(r.Samples))
+	}
+	return s
+}
+
+// summary returns the result in the short form shown next to a host.
+func (r pingResult) summary() string {
+	if r.Received == 0 {
+		return fmt.Sprintf("%g%% loss", r.Loss)
+	}
+	return fmt.Sprintf("%v, %g%% loss %s", roundRtt(r.Avg), r.Loss, sparkline(r.Samples))
+}
+
+// roundRtt returns 'd' rounded to a precision fitting round-trip times.
+func roundRtt(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
+
+// sparkline returns 'samples' drawn as a line of blocks, where the lowest
+// value gets the lowest block and the highest value gets the highest block.
+func sparkline(samples []time.Duration) string {
+	if len(samples) == 0 {
+		return ""
+	}
+	low, high := slices.Min(samples), slices.Max(samples)
+
+	var b strings.Builder
+	for _, s := range samples {
+		b.WriteRune(sparklineBlock(s, low, high))
+	}
+	return b.String()
+}
+
+// sparklineBlock returns the block drawn for 's' in a sparkline ranging
+// from 'low' to 'high'.
+func sparklineBlock(s, low, high time.Duration) rune {
+	n := 0
+	if high > low {
+		n = int((s - low) * time.Duration(len(sparklineBlocks)-1) / (high - low))
+	}
+	return sparklineBlocks[n]
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Ways of probing whether a host is reachable.
+const (
+	icmpProbe = "icmp"
+	tcpProbe  = "tcp"
+)
+
+// defaultProbeTimeout is how long a TCP probe may take before the host is
+// considered unreachable.
+const defaultProbeTimeout = 5 * time.Second
+
+// maxBannerLines is how many lines a server may send before its SSH version
+// string, which RFC 4253 allows for, before giving up on finding it.
+const maxBannerLines = 20
+
+// A probeResult is the outcome of probing the SSH port of a host.
+type probeResult struct {
+	Address string
+	// Via is the ProxyJump chain the probe went through, if any
+	Via     string
+	Latency time.Duration
+	Banner  string
+	Err     error
+}
+
+// String returns the result in the form shown in the status bar.
+func (r probeResult) String() string {
+	target := r.Address
+	if r.Via != "" {
+		target = fmt.Sprintf("%s via %s", target, r.Via)
+	}
+	if r.Err != nil {
+		return fmt.Sprintf("%s unreachable: %v", target, r.Err)
+	}
+	return fmt.Sprintf("%s open in %v: %s", target, r.Latency.Round(time.Microsecond), r.Banner)
+}
+
+// connectHost returns the host an Item is connected to. Hosts from an SSH
+// configuration are reached through their HostName, whereas hosts from
+// elsewhere are connected to by the name in their Host field.
+func (i Item) connectHost() string {
+	if source := i.source(); source == "" || strings.HasPrefix(source, sshConfigSource) {
+		return i.Hostname
+	}
+	return i.Host
+}
+
+// probeAddress returns the address of the SSH port of an Item.
+func (i Item) probeAddress() string {
+	port := i.Port
+	if port == "" {
+		port = "22"
+	}
+	return net.JoinHostPort(i.connectHost(), port)
+}
+
+// probeItem probes the SSH port of 'i' within 'timeout', going through its
+// ProxyJump chain when it has one.
+func probeItem(ctx context.Context, i Item, sshOpts []string, timeout time.Duration) probeResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	address := i.probeAddress()
+	if i.ProxyJump != "" && i.ProxyJump != "none" {
+		return probeProxy(ctx, address, i.ProxyJump, sshOpts)
+	}
+	return probeTCP(ctx, address)
+}
+
+// probeTCP dials 'address' directly and reads the SSH version string the
+// server sends. The latency is the time it took to establish the connection.
+func probeTCP(ctx context.Context, address string) probeResult {
+	result := probeResult{Address: address}
+
+	var d net.Dialer
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer conn.Close()
+	result.Latency = time.Since(start)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	}
+	result.Banner, result.Err = readBanner(conn)
+	return result
+}
+
+// probeProxy reaches 'address' through the 'proxyJump' chain by having SSH
+// forward its standard input and output to it with '-W', reusing the
+// control master of the last jump host, and reads the SSH version string
+// from there. The latency includes setting up the chain, which is mostly
+// nothing once a control master is running.
+func probeProxy(ctx context.Context, address, proxyJump string, sshOpts []string) probeResult {
+	result := probeResult{Address: address, Via: proxyJump}
+
+	var stderr bytes.Buffer
+	c := exec.CommandContext(ctx, sshExecutableName, proxyProbeArgs(address, proxyJump, sshOpts)...)
+	c.Stderr = &stderr
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	start := time.Now()
+	if err := c.Start(); err != nil {
+		result.Err = err
+		return result
+	}
+	result.Banner, result.Err = readBanner(stdout)
+	result.Latency = time.Since(start)
+
+	// The forwarding is only needed until the version string is read
+	c.Process.Kill()
+	c.Wait()
+	if result.Err != nil && stderr.Len() > 0 {
+		result.Err = fmt.Errorf("%w: %s", result.Err, strings.TrimSpace(stderr.String()))
+	}
+	return result
+}
+
+// proxyProbeArgs returns the arguments given to SSH for forwarding to
+// 'address' from the last host in the comma-separated 'proxyJump' chain.
+func proxyProbeArgs(address, proxyJump string, sshOpts []string) []string {
+	return append([]string{"-W", address}, lastHopArgs(proxyJump, sshOpts)...)
+}
+
+// lastHopArgs returns the arguments given to SSH for connecting to the last
+// host in the comma-separated 'proxyJump' chain, with the hosts before it
+// given as jump hosts of their own.
+func lastHopArgs(proxyJump string, sshOpts []string) []string {
+	hops := strings.Split(proxyJump, ",")
+	last := hops[len(hops)-1]
+
+	var args []string
+	if len(hops) > 1 {
+		args = append(args, "-J", strings.Join(hops[:len(hops)-1], ","))
+	}
+	args = append(args, sshOpts...)
+	args = append(args, "-o", "BatchMode=yes")
+	args = append(args, sshControl.parentOpts(Item{})...)
+
+	// Jump hosts may have a port, which SSH only takes as part of a URI
+	if _, _, err := net.SplitHostPort(last); err == nil {
+		last = "ssh://" + last
+	}
+	return append(args, last)
+}
+
+// readBanner returns the SSH version string read from 'r', skipping over any
+// other lines sent before it.
+func readBanner(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for n := 0; n < maxBannerLines && scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "SSH-") {
+			return line, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("no SSH version string received")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+
+	"charm.land/bubbles/v2/list"
+)
+
+// resolveWorkers is the number of 'ssh -G' processes run at the same time
+// when resolving multiple hosts.
+const resolveWorkers = 8
+
+// resolvedKeywords are the keywords compared between the options found by
+// parsing an SSH configuration and those computed by 'ssh -G'.
+var resolvedKeywords = []string{"hostname", "user", "port", "proxyjump", "identityfile"}
+
+// resolveHost returns the options OpenSSH itself computes for 'host' by
+// running 'ssh -G', which evaluates the configuration without connecting.
+//
+// Any 'sshOpts' (e.g. '-F' for a different configuration file) are passed
+// along to SSH.
+func resolveHost(ctx context.Context, host string, sshOpts []string) ([]sshOption, error) {
+	args := append(append([]string{"-G"}, sshOpts...), host)
+	var stderr bytes.Buffer
+	c := exec.CommandContext(ctx, sshExecutableName, args...)
+	c.Stderr = &stderr
+
+	out, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve '%s': %w: %s", host, err, strings.TrimSpace(stderr.String()))
+	}
+	return parseResolvedOptions(out), nil
+}
+
+// parseResolvedOptions returns the options found in the output of 'ssh -G',
+// which has a lowercase keyword followed by its value on each line.
+func parseResolvedOptions(out []byte) []sshOption {
+	var options []sshOption
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		options = append(options, sshOption{Keyword: fields[0], Args: fields[1:]})
+	}
+	return options
+}
+
+// resolveItems returns a copy of 'items' where each 'Item' has its fields
+// filled in from what 'ssh -G' computes for it, along with an error for each
+// host that could not be resolved. Hosts that could not be resolved are left
+// as they were. The user and port are only filled in when they aren't the
+// defaults, as 'ssh -G' always prints them.
+func resolveItems(ctx context.Context, items []list.Item, sshOpts []string) ([]list.Item, []error) {
+	resolved := make([]list.Item, len(items))
+	errs := make([]error, len(items))
+	localUser := localUsername()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, resolveWorkers)
+	for n, li := range items {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			i := li.(Item)
+			options, err := resolveHost(ctx, i.Host, sshOpts)
+			if err != nil {
+				resolved[n], errs[n] = i, err
+				return
+			}
+			r := newSshConfigItem(i.Host, options)
+			if r.User == localUser {
+				r.User = ""
+			}
+			if r.Port == "22" {
+				r.Port = ""
+			}
+			r.SwitchFilter = i.SwitchFilter
+			r.Origins = i.Origins
+			resolved[n] = r
+		}()
+	}
+	wg.Wait()
+
+	return resolved, slices.DeleteFunc(errs, func(err error) bool { return err == nil })
+}
+
+// compareResolved returns a line for every difference between the options
+// in 'parsed' and those in 'resolved' for the keywords in 'resolvedKeywords',
+// taking into account the values SSH uses when an option isn't set.
+func compareResolved(parsed, resolved Item, localUser string) []string {
+	var diffs []string
+	for _, keyword := range resolvedKeywords {
+		ours := optionValues(parsed.Options, keyword)
+		theirs := optionValues(resolved.Options, keyword)
+
+		switch keyword {
+		case "hostname":
+			ours = []string{parsed.Hostname}
+		case "user":
+			if len(ours) == 0 {
+				ours = []string{localUser}
+			}
+		case "port":
+			if len(ours) == 0 {
+				ours = []string{"22"}
+			}
+		case "proxyjump":
+			if len(theirs) == 0 {
+				theirs = ours
+			}
+		case "identityfile":
+			// Without any configured identities SSH lists the defaults
+			if len(ours) == 0 {
+				continue
+			}
+		}
+
+		equal := slices.Equal[[]string]
+		if keyword == "hostname" {
+			// SSH prints hostnames in lowercase
+			equal = func(a, b []string) bool { return slices.EqualFunc(a, b, strings.EqualFold) }
+		}
+		if !equal(ours, theirs) {
+			diffs = append(diffs, fmt.Sprintf("%s: %s: parsed %q, ssh -G %q", parsed.Host, keyword, strings.Join(ours, " "), strings.Join(theirs, " ")))
+		}
+	}
+	return diffs
+}
+
+// optionValues returns the arguments of every option named 'keyword' in
+// 'options', each joined by spaces.
+func optionValues(options []sshOption, keyword string) []string {
+	var values []string
+	for _, o := range options {
+		if o.Keyword == keyword {
+			values = append(values, strings.Join(o.Args, " "))
+		}
+	}
+	return values
+}
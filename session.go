@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+)
+
+// A sessionResult is how a session with a host ended in loop mode.
+type sessionResult struct {
+	ExitCode int
+	Duration time.Duration
+}
+
+// String returns the result in the form shown next to the host.
+func (r sessionResult) String() string {
+	return fmt.Sprintf("exited %d after %v", r.ExitCode, r.Duration.Round(time.Second))
+}
+
+// summary returns what is printed once connected, before the
+// session starts: how long connecting took and each phase of
+// it, followed by whatever the connection printed.
+func (c connection) summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Connected in %v\n", c.startupTime)
+	if len(c.phases) > 0 {
+		phases := make([]string, len(c.phases))
+		for n, p := range c.phases {
+			phases[n] = p.String()
+		}
+		fmt.Fprintf(&b, "(%s)\n", strings.Join(phases, ", "))
+	}
+	fmt.Fprintln(&b, c.output)
+	return b.String()
+}
+
+// A sessionExec runs a session with a host in the terminal
+// while the program waits, printing 'header' before it and
+// recording how it ended.
+type sessionExec struct {
+	cmd    *exec.Cmd
+	header string
+	result sessionResult
+}
+
+// SetStdin sets the standard input of the session unless it was
+// already set.
+func (s *sessionExec) SetStdin(r io.Reader) {
+	if s.cmd.Stdin == nil {
+		s.cmd.Stdin = r
+	}
+}
+
+// SetStdout sets the standard output of the session unless it
+// was already set.
+func (s *sessionExec) SetStdout(w io.Writer) {
+	if s.cmd.Stdout == nil {
+		s.cmd.Stdout = w
+	}
+}
+
+// SetStderr sets the standard error of the session unless it was
+// already set.
+func (s *sessionExec) SetStderr(w io.Writer) {
+	if s.cmd.Stderr == nil {
+		s.cmd.Stderr = w
+	}
+}
+
+// Run prints the header and runs the session until it ends. The
+// session ending with an exit code other than zero is how it
+// went rather than an error.
+func (s *sessionExec) Run() error {
+	if s.cmd.Stdout != nil {
+		fmt.Fprint(s.cmd.Stdout, s.header)
+	}
+	started := time.Now()
+	err := s.cmd.Run()
+	s.result.Duration = time.Since(started)
+	s.result.ExitCode = -1
+	if s.cmd.ProcessState != nil {
+		s.result.ExitCode = s.cmd.ProcessState.ExitCode()
+	}
+	if exitErr := (*exec.ExitError)(nil); errors.As(err, &exitErr) {
+		return nil
+	}
+	return err
+}
+
+// A sessionDoneMsg indicates that the session with 'item' ended
+// with 'result', or the error that prevented it from running.
+type sessionDoneMsg struct {
+	item   Item
+	result sessionResult
+	err    error
+}
+
+// sessionCommand returns a command that hands the terminal over to
+// SSH for a session with 'i' using 'args', which reuses the
+// control master left by connecting, and brings the program back
+// once it ends.
+func sessionCommand(i Item, args []string, header string) tea.Cmd {
+	s := &sessionExec{cmd: exec.Command(sshExecutableName, args...), header: header}
+	return tea.Exec(s, func(err error) tea.Msg {
+		return sessionDoneMsg{item: i, result: s.result, err: err}
+	})
+}
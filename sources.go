@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"charm.land/bubbles/v2/list"
+)
+
+// Kinds of sources built into the program, which also label where an 'Item'
+// came from.
+const (
+	sshConfigSource  = "ssh_config"
+	inventorySource  = "inventory"
+	commandSource    = "command"
+	knownHostsSource = "known_hosts"
+)
+
+// An itemOrigin records where an 'Item' was found: the name of the source,
+// and the file and line within it when those are known.
+type itemOrigin struct {
+	Source string
+	File   string `json:",omitempty"`
+	Line   int    `json:",omitempty"`
+}
+
+// String returns the origin as 'source file:line', leaving out whatever
+// isn't known.
+func (o itemOrigin) String() string {
+	s := o.Source
+	if o.File != "" {
+		s = fmt.Sprintf("%s %s", s, o.File)
+		if o.Line > 0 {
+			s = fmt.Sprintf("%s:%d", s, o.Line)
+		}
+	}
+	return s
+}
+
+// setOriginFile sets the file of the origin of every item in 'items' to
+// 'filePath'.
+func setOriginFile(items []list.Item, filePath string) {
+	for n, li := range items {
+		i := li.(Item)
+		for o := range i.Origins {
+			i.Origins[o].File = filePath
+		}
+		items[n] = i
+	}
+}
+
+// A HostSource is a provider of hosts, such as a file or a command.
+//
+// New kinds of sources are made available to the '-source' flag by calling
+// 'registerHostSource' from an 'init' function in their own file.
+type HostSource interface {
+	// Name returns the name shown for the hosts of the source.
+	Name() string
+	// Load returns the hosts currently in the source. Hosts returned along
+	// with an error are still listed.
+	Load(ctx context.Context) ([]list.Item, error)
+}
+
+// A HostSourceWatcher is a 'HostSource' that can tell when its hosts may
+// have changed.
+type HostSourceWatcher interface {
+	HostSource
+	// Watch calls 'changed' whenever the hosts may have changed until 'ctx'
+	// is done.
+	Watch(ctx context.Context, changed func())
+}
+
+// A hostSourceFactory returns a 'HostSource' called 'name' for the 'value'
+// given after its kind with the '-source' flag.
+type hostSourceFactory func(name, value string, opts sourceOptions) (HostSource, error)
+
+// hostSourceFactories holds a factory for every kind of source.
+var hostSourceFactories = make(map[string]hostSourceFactory)
+
+// registerHostSource makes sources of 'kind' available through 'factory'.
+// Registering the same kind twice is a programming error.
+func registerHostSource(kind string, factory hostSourceFactory) {
+	if _, ok := hostSourceFactories[kind]; ok {
+		panic(fmt.Sprintf("host source '%s' registered twice", kind))
+	}
+	hostSourceFactories[kind] = factory
+}
+
+// sourceOptions holds the settings shared by every 'HostSource'.
+type sourceOptions struct {
+	SshConfigPath   string
+	KnownHostsPath  string
+	IncludeDir      string
+	InventoryFormat string
+	SwitchFilter    bool
+}
+
+// A sourceSpec describes a single place to read hosts from, as given with
+// the '-source' flag in the form 'kind' or 'kind:value'.
+//
+// What the value means is up to the kind of source, e.g. a path or a
+// command to run.
+type sourceSpec struct {
+	Kind  string
+	Value string
+	// Label is the name shown for the source, which is its kind unless more
+	// than one source of the same kind is used.
+	Label string
+}
+
+// parseSourceSpec returns the 'sourceSpec' described by 's'.
+func parseSourceSpec(s string) (sourceSpec, error) {
+	kind, value, _ := strings.Cut(s, ":")
+	if _, ok := hostSourceFactories[kind]; !ok {
+		return sourceSpec{}, fmt.Errorf("unknown source '%s'", kind)
+	}
+	return sourceSpec{Kind: kind, Value: value, Label: kind}, nil
+}
+
+// open returns the 'HostSource' described by the spec.
+func (s sourceSpec) open(opts sourceOptions) (HostSource, error) {
+	source, err := hostSourceFactories[s.Kind](s.Label, s.Value, opts)
+	if err != nil {
+		return nil, fmt.Errorf("source '%s': %w", s.Label, err)
+	}
+	return source, nil
+}
+
+// labelSources gives every source in 'specs' its label, which is its kind
+// unless there is more than one source of the same kind. Those are told apart
+// by the base name of their value, e.g. 'inventory:prod.ini', or by their
+// position for commands.
+func labelSources(specs []sourceSpec) {
+	counts := make(map[string]int)
+	for _, s := range specs {
+		counts[s.Kind]++
+	}
+	for n, s := range specs {
+		switch {
+		case counts[s.Kind] == 1:
+			specs[n].Label = s.Kind
+		case s.Kind == commandSource || s.Value == "":
+			specs[n].Label = fmt.Sprintf("%s:%d", s.Kind, n+1)
+		default:
+			specs[n].Label = fmt.Sprintf("%s:%s", s.Kind, filepath.Base(s.Value))
+		}
+	}
+}
+
+// sortByPrecedence sorts 'specs' so that those whose label or kind comes
+// first in the comma-separated 'precedence' are first, keeping the given
+// order otherwise. Sources not named in 'precedence' come last.
+func sortByPrecedence(specs []sourceSpec, precedence string) error {
+	if precedence == "" {
+		return nil
+	}
+	order := strings.Split(precedence, ",")
+	for _, name := range order {
+		if !slices.ContainsFunc(specs, func(s sourceSpec) bool { return s.Label == name || s.Kind == name }) {
+			return fmt.Errorf("unknown source '%s' in precedence", name)
+		}
+	}
+
+	rank := func(s sourceSpec) int {
+		if n := slices.Index(order, s.Label); n != -1 {
+			return n
+		}
+		if n := slices.Index(order, s.Kind); n != -1 {
+			return n
+		}
+		return len(order)
+	}
+	slices.SortStableFunc(specs, func(a, b sourceSpec) int { return rank(a) - rank(b) })
+	return nil
+}
+
+// A sourceFlag is a repeatable flag collecting every '-source' given.
+type sourceFlag []sourceSpec
+
+// String returns the sources given so far.
+func (f *sourceFlag) String() string {
+	var s []string
+	for _, spec := range *f {
+		s = append(s, strings.TrimSuffix(fmt.Sprintf("%s:%s", spec.Kind, spec.Value), ":"))
+	}
+	return strings.Join(s, ", ")
+}
+
+// Set adds the source described by 'value'.
+func (f *sourceFlag) Set(value string) error {
+	spec, err := parseSourceSpec(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, spec)
+	return nil
+}
+
+// loadSources returns the hosts found in each of 'sources', in the same
+// order as the sources, with every host's origin named after its source.
+//
+// A source that could not be read doesn't stop the others from being read,
+// and an error is returned for each of them instead.
+func loadSources(ctx context.Context, sources []HostSource) ([][]list.Item, []error) {
+	var (
+		lists [][]list.Item
+		errs  []error
+	)
+	for _, s := range sources {
+		items, err := s.Load(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("source '%s': %w", s.Name(), err))
+		}
+		for n, li := range items {
+			i := li.(Item)
+			if len(i.Origins) == 0 {
+				i.Origins = []itemOrigin{{}}
+			}
+			for o := range i.Origins {
+				i.Origins[o].Source = s.Name()
+			}
+			items[n] = i
+		}
+		lists = append(lists, items)
+	}
+	return lists, errs
+}
+
+// watchSources calls 'changed' whenever any of 'sources' that can be watched
+// reports that its hosts may have changed, until 'ctx' is done.
+func watchSources(ctx context.Context, sources []HostSource, changed func()) {
+	for _, s := range sources {
+		if w, ok := s.(HostSourceWatcher); ok {
+			go w.Watch(ctx, changed)
+		}
+	}
+}
+
+// sourcePollInterval is how often the files of a source are checked for
+// changes when watching it.
+const sourcePollInterval = 2 * time.Second
+
+// A watchedFiles holds the files a source reads, which are watched for
+// changes by polling their modification times. Sources embedding it are
+// 'HostSourceWatcher's.
+type watchedFiles struct {
+	mu    sync.Mutex
+	files []string
+}
+
+// setFiles replaces the watched files with 'files'.
+func (w *watchedFiles) setFiles(files ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.files = files
+}
+
+// modTimes returns the modification time of every watched file, which is
+// the zero time for files that don't exist.
+func (w *watchedFiles) modTimes() map[string]time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	times := make(map[string]time.Time)
+	for _, f := range w.files {
+		var t time.Time
+		if info, err := os.Stat(f); err == nil {
+			t = info.ModTime()
+		}
+		times[f] = t
+	}
+	return times
+}
+
+// Watch calls 'changed' whenever any of the watched files is created,
+// modified, or removed, until 'ctx' is done.
+func (w *watchedFiles) Watch(ctx context.Context, changed func()) {
+	ticker := time.NewTicker(sourcePollInterval)
+	defer ticker.Stop()
+
+	last := w.modTimes()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := w.modTimes()
+		if filesChanged(last, current) {
+			changed()
+		}
+		last = current
+	}
+}
+
+// filesChanged reports whether any of the files in 'last' has a different
+// modification time in 'current'. Files only in 'current' were added to the
+// watched files by loading the source again, so they don't count.
+func filesChanged(last, current map[string]time.Time) bool {
+	for f, t := range last {
+		if c, ok := current[f]; ok && !c.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeItems returns a slice of 'list.Item' with the items of every list in
+// 'lists' where items connected to at the same host and port as an item
+// from an earlier list are merged into it. The earlier item is kept, but it gains
+// the later item's origins and key type, so lists should be given from the
+// highest precedence to the lowest. Items within the same list are never
+// merged as they are separate entries in the same source (e.g. aliases).
+//
+// When there is more than one list every item is marked to show where it
+// came from as there may now be more than one place.
+func mergeItems(lists ...[]list.Item) []list.Item {
+	var (
+		items []list.Item
+		index = make(map[string]int)
+	)
+
+	for _, l := range lists {
+		added := make(map[string]int)
+		for _, li := range l {
+			i := li.(Item)
+			i.ShowSource = len(lists) > 1
+
+			key := strings.ToLower(i.probeAddress())
+
+			n, ok := index[key]
+			if !ok {
+				if _, ok := added[key]; !ok {
+					added[key] = len(items)
+				}
+				items = append(items, i)
+				continue
+			}
+
+			existing := items[n].(Item)
+			if existing.KeyType == "" {
+				existing.KeyType = i.KeyType
+			}
+			existing.Origins = append(slices.Clip(existing.Origins), i.Origins...)
+			items[n] = existing
+		}
+		maps.Copy(index, added)
+	}
+
+	return items
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"charm.land/bubbles/v2/list"
+)
+
+// An sshOption is a single keyword along with its arguments as found in an SSH
+// configuration. Keywords are case-insensitive, so they are always stored in
+// lowercase.
+type sshOption struct {
+	Keyword string
+	Args    []string
+}
+
+// An sshConfigBlock is a section of an SSH configuration that starts with
+// either a 'Host' or a 'Match' keyword and holds every option up until the
+// next section. Options preceding the first section of a file are kept in a
+// block without a keyword.
+//
+// Blocks read from a file included within another section only apply when
+// the section they were included from, given by the index in 'Parent',
+// applies as well. Options following an 'Include' within a section are kept
+// in a block without a keyword that has the section as its parent.
+//
+// A block is invalid when any of its lines could not be parsed, in which
+// case none of its options are used.
+type sshConfigBlock struct {
+	Keyword  string
+	Patterns []string
+	Options  []sshOption
+	File     string
+	Line     int
+	Parent   int
+	Invalid  bool
+}
+
+// An sshConfig is a parsed SSH configuration along with every file it
+// includes.
+type sshConfig struct {
+	Blocks        []sshConfigBlock
+	Files         []string
+	Errors        []error
+	IncludeErrors []error
+}
+
+// sshMultiValueKeywords are keywords that may be given more than once with
+// every value being used, unlike all others where the first obtained value
+// is the one that wins.
+var sshMultiValueKeywords = map[string]bool{
+	"certificatefile": true,
+	"dynamicforward":  true,
+	"identityfile":    true,
+	"localforward":    true,
+	"remoteforward":   true,
+	"sendenv":         true,
+	"setenv":          true,
+}
+
+// maxIncludeDepth is the maximum depth of nested 'Include' options, which is
+// the same as the one used by OpenSSH.
+const maxIncludeDepth = 16
+
+// An includeError is returned when any of the 'Include' options in an SSH
+// configuration could not be followed. The hosts from everything that could
+// be read are still returned alongside it.
+type includeError struct {
+	errs []error
+}
+
+func (e *includeError) Error() string {
+	msgs := make([]string, len(e.errs))
+	for n, err := range e.errs {
+		msgs[n] = err.Error()
+	}
+	return fmt.Sprintf("could not follow %d include(s): %s", len(e.errs), strings.Join(msgs, "; "))
+}
+
+func (e *includeError) Unwrap() []error { return e.errs }
+
+// An sshConfigLoader reads an SSH configuration while following its
+// 'Include' options, which are read in place as if their contents were
+// present where they were included.
+type sshConfigLoader struct {
+	// includeDir is what relative 'Include' paths are relative to
+	includeDir string
+	// files holds every file currently being read for detecting cycles
+	files []string
+	cfg   sshConfig
+}
+
+// loadSshConfig returns the SSH configuration read from 'filePath' where
+// relative 'Include' paths are resolved against 'includeDir' in the same way
+// OpenSSH resolves them against '~/.ssh'.
+func loadSshConfig(filePath, includeDir string) (sshConfig, error) {
+	l := sshConfigLoader{includeDir: includeDir}
+	if err := l.load(expandTilde(filePath), -1); err != nil {
+		return sshConfig{}, err
+	}
+	return l.cfg, nil
+}
+
+// parseSshConfig returns an 'sshConfig' from the given 'content' slice of
+// bytes following the rules laid out in ssh_config(5). Relative 'Include'
+// paths are resolved against the current working directory.
+//
+// Lines that can't be parsed don't stop the parsing, but they invalidate the
+// block they are in and are recorded in the returned configuration's errors.
+func parseSshConfig(content []byte) sshConfig {
+	var l sshConfigLoader
+	l.parse(content, "", -1)
+	return l.cfg
+}
+
+// load reads the file at 'filePath' as part of the configuration where the
+// blocks in it have 'parent' as their parent.
+func (l *sshConfigLoader) load(filePath string, parent int) error {
+	if slices.Contains(l.files, filePath) {
+		return fmt.Errorf("'%s' includes itself", filePath)
+	}
+	if len(l.files) > maxIncludeDepth {
+		return fmt.Errorf("'%s' exceeds maximum include depth of %d", filePath, maxIncludeDepth)
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("could not read file '%s': %w", filePath, err)
+	}
+
+	l.files = append(l.files, filePath)
+	l.cfg.Files = append(l.cfg.Files, filePath)
+	l.parse(content, filePath, parent)
+	l.files = l.files[:len(l.files)-1]
+	return nil
+}
+
+// parse adds the blocks found in 'content' read from 'file' to the
+// configuration, each having 'parent' as their parent.
+func (l *sshConfigLoader) parse(content []byte, file string, parent int) {
+	l.cfg.Blocks = append(l.cfg.Blocks, sshConfigBlock{File: file, Parent: parent})
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		keyword, args, err := splitSshConfigLine(scanner.Text())
+		current := len(l.cfg.Blocks) - 1
+		switch {
+		case err != nil:
+			l.cfg.Blocks[current].Invalid = true
+			l.cfg.Errors = append(l.cfg.Errors, fmt.Errorf("%s:%d: %w", file, n, err))
+		case keyword == "":
+			continue
+		case len(args) == 0:
+			l.cfg.Blocks[current].Invalid = true
+			l.cfg.Errors = append(l.cfg.Errors, fmt.Errorf("%s:%d: missing argument for %q", file, n, keyword))
+		case keyword == "host" || keyword == "match":
+			l.cfg.Blocks = append(l.cfg.Blocks, sshConfigBlock{Keyword: keyword, Patterns: args, File: file, Line: n, Parent: parent})
+		case keyword == "include":
+			// Both the included files and whatever follows the 'Include'
+			// belong to the same section as the 'Include' itself
+			section := current
+			if l.cfg.Blocks[current].Keyword == "" {
+				section = l.cfg.Blocks[current].Parent
+			}
+			l.include(args, section)
+			l.cfg.Blocks = append(l.cfg.Blocks, sshConfigBlock{File: file, Line: n, Parent: section})
+		default:
+			l.cfg.Blocks[current].Options = append(l.cfg.Blocks[current].Options, sshOption{Keyword: keyword, Args: args})
+		}
+	}
+}
+
+// include reads every file matching the 'patterns' of an 'Include' option
+// with the blocks in them having 'parent' as their parent.
+//
+// Patterns may contain any number of wildcards. A pattern without wildcards
+// that doesn't match a file is recorded as an error, just like empty
+// patterns and files that can't be read or that would result in a cycle.
+func (l *sshConfigLoader) include(patterns []string, parent int) {
+	for _, p := range patterns {
+		if p == "" {
+			l.cfg.IncludeErrors = append(l.cfg.IncludeErrors, errors.New("empty pattern"))
+			continue
+		}
+		p = expandTilde(p)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(l.includeDir, p)
+		}
+
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			l.cfg.IncludeErrors = append(l.cfg.IncludeErrors, fmt.Errorf("invalid pattern '%s': %w", p, err))
+			continue
+		}
+		if len(matches) == 0 && !strings.ContainsAny(p, "*?[") {
+			l.cfg.IncludeErrors = append(l.cfg.IncludeErrors, fmt.Errorf("could not read file '%s': %w", p, os.ErrNotExist))
+			continue
+		}
+
+		for _, m := range matches {
+			if err := l.load(m, parent); err != nil {
+				l.cfg.IncludeErrors = append(l.cfg.IncludeErrors, err)
+			}
+		}
+	}
+}
+
+// splitSshConfigLine returns the lowercase keyword and the arguments found on
+// a single 'line' of an SSH configuration.
+//
+// The keyword may be separated from its arguments by whitespace or by an
+// optional equals sign. Arguments are separated by whitespace, may be quoted
+// with double or single quotes, and a '#' at the start of an argument
+// comments out the rest of the line. An empty keyword is returned for blank
+// and commented lines.
+func splitSshConfigLine(line string) (string, []string, error) {
+	line = strings.TrimLeft(line, " \t")
+	if line == "" || line[0] == '#' {
+		return "", nil, nil
+	}
+
+	end := strings.IndexAny(line, " \t\r=")
+	if end == -1 {
+		return strings.ToLower(line), nil, nil
+	}
+	keyword := strings.ToLower(line[:end])
+
+	rest := strings.TrimLeft(line[end:], " \t\r")
+	if strings.HasPrefix(rest, "=") {
+		rest = rest[1:]
+	}
+
+	args, err := splitSshConfigArgs(rest)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid arguments for %q: %w", keyword, err)
+	}
+	return keyword, args, nil
+}
+
+// splitSshConfigArgs returns the arguments found in 's' in the same way as
+// OpenSSH splits them: by whitespace outside of quotes, with a backslash
+// escaping a following quote, backslash, or space.
+func splitSshConfigArgs(s string) ([]string, error) {
+	var (
+		args  []string
+		arg   strings.Builder
+		quote byte
+		inArg bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(`\"'`, s[i+1]) != -1,
+			c == '\\' && i+1 < len(s) && quote == 0 && s[i+1] == ' ':
+			i++
+			arg.WriteByte(s[i])
+			inArg = true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteByte(c)
+		case c == ' ' || c == '\t' || c == '\r':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case c == '#' && !inArg:
+			return args, nil
+		case c == '"' || c == '\'':
+			quote = c
+			inArg = true
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// appendOptions appends to 'options' each of 'add' that hasn't been obtained
+// yet according to 'seen', which is updated accordingly.
+func appendOptions(options []sshOption, seen map[string]bool, add []sshOption) []sshOption {
+	for _, o := range add {
+		if seen[o.Keyword] && !sshMultiValueKeywords[o.Keyword] {
+			continue
+		}
+		seen[o.Keyword] = true
+		options = append(options, o)
+	}
+	return options
+}
+
+// An sshConfigHost is a host named in a 'Host' section along with the file
+// and line where it was first named.
+type sshConfigHost struct {
+	Name string
+	File string
+	Line int
+}
+
+// hosts returns every host named in a valid 'Host' block in the order they
+// first appear. Patterns containing wildcards and negated patterns are not
+// hosts that can be connected to, so they are left out.
+func (c sshConfig) hosts() []sshConfigHost {
+	var hosts []sshConfigHost
+	seen := make(map[string]bool)
+
+	for _, b := range c.Blocks {
+		if b.Invalid || b.Keyword != "host" {
+			continue
+		}
+		for _, p := range b.Patterns {
+			if seen[p] || strings.ContainsAny(p, "*?!") {
+				continue
+			}
+			seen[p] = true
+			hosts = append(hosts, sshConfigHost{Name: p, File: b.File, Line: b.Line})
+		}
+	}
+
+	return hosts
+}
+
+// items returns a slice of 'list.Item' for every host in the configuration
+// with the options that SSH would use for each evaluated against 'env'.
+func (c sshConfig) items(env *sshMatchEnv) []list.Item {
+	hosts := c.hosts()
+	items := make([]list.Item, len(hosts))
+
+	// Hosts are evaluated side by side as the commands of any 'Match exec'
+	// criteria may take a while
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, matchExecWorkers)
+	for n, host := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			i := newSshConfigItem(host.Name, c.effectiveOptions(host.Name, env))
+			i.Origins[0].File, i.Origins[0].Line = host.File, host.Line
+			items[n] = i
+		}()
+	}
+	wg.Wait()
+
+	return items
+}
+
+// newSshConfigItem returns an 'Item' for 'host' with fields filled in from
+// the given effective 'options'.
+func newSshConfigItem(host string, options []sshOption) Item {
+	i := Item{Host: host, Hostname: host, Options: options, Origins: []itemOrigin{{Source: sshConfigSource}}}
+	for _, o := range options {
+		switch o.Keyword {
+		case "hostname":
+			i.Hostname = expandHostnameTokens(o.Args[0], host)
+		case "user":
+			i.User = o.Args[0]
+		case "port":
+			i.Port = o.Args[0]
+		case "proxyjump":
+			i.ProxyJump = o.Args[0]
+		}
+	}
+	return i
+}
+
+// expandHostnameTokens returns 'hostname' with the tokens allowed in a
+// 'HostName' value expanded: '%h' to the given 'host' and '%%' to a literal
+// percent sign.
+func expandHostnameTokens(hostname, host string) string {
+	return strings.NewReplacer("%%", "%", "%h", host).Replace(hostname)
+}
+
+func init() {
+	registerHostSource(sshConfigSource, newSshConfigHostSource)
+}
+
+// An sshConfigHostSource is a 'HostSource' for the hosts of an SSH
+// configuration, which is watched along with every file it includes.
+type sshConfigHostSource struct {
+	watchedFiles
+	name       string
+	path       string
+	includeDir string
+}
+
+// newSshConfigHostSource returns an 'sshConfigHostSource' for the SSH
+// configuration at path 'value', or at the path given with '-sshconfigpath'
+// when 'value' is empty.
+func newSshConfigHostSource(name, value string, opts sourceOptions) (HostSource, error) {
+	return &sshConfigHostSource{
+		name:       name,
+		path:       expandTilde(cmp.Or(value, opts.SshConfigPath)),
+		includeDir: opts.IncludeDir,
+	}, nil
+}
+
+func (s *sshConfigHostSource) Name() string { return s.name }
+
+// Load returns the hosts of the SSH configuration, along with an error of
+// type '*includeError' when some of its 'Include' options could not be
+// followed.
+func (s *sshConfigHostSource) Load(ctx context.Context) ([]list.Item, error) {
+	cfg, err := loadSshConfig(s.path, s.includeDir)
+	// The configuration itself is watched even when it can't be read
+	s.setFiles(append([]string{s.path}, cfg.Files...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	items := cfg.items(newSshMatchEnv())
+	if len(cfg.IncludeErrors) > 0 {
+		return items, &includeError{errs: cfg.IncludeErrors}
+	}
+	return items, nil
+}
+
+// resolveOpts returns the options 'ssh -G' needs to read the same SSH
+// configuration as the source.
+func (s *sshConfigHostSource) resolveOpts() []string {
+	if s.path == defaultSshConfigPath {
+		return nil
+	}
+	return []string{"-F", s.path}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+)
+
+// matchExecTimeout is how long a command given to 'Match exec' may run before
+// it is considered to have failed.
+const matchExecTimeout = 5 * time.Second
+
+// matchExecWorkers is the number of hosts whose 'Match' sections are
+// evaluated at the same time.
+const matchExecWorkers = 8
+
+// matchExecDeadline is how long every command given to 'Match exec' may take
+// together, after which the commands that are left are considered to have
+// failed without being run. Listing hosts doesn't wait longer than that.
+const matchExecDeadline = 10 * time.Second
+
+// An sshMatchEnv holds everything 'Match' criteria are evaluated against that
+// doesn't come from the SSH configuration itself.
+type sshMatchEnv struct {
+	LocalUser string
+	// Exec reports whether the given command exits successfully.
+	Exec func(command string) bool
+}
+
+// newSshMatchEnv returns an 'sshMatchEnv' for the user executing the program
+// where commands are run through the user's shell until 'matchExecDeadline'
+// has passed. Their results are cached for the lifetime of the environment,
+// which may be used by several hosts at the same time.
+func newSshMatchEnv() *sshMatchEnv {
+	var (
+		mu       sync.Mutex
+		results  = make(map[string]func() bool)
+		deadline = time.Now().Add(matchExecDeadline)
+	)
+	return &sshMatchEnv{
+		LocalUser: localUsername(),
+		Exec: func(command string) bool {
+			mu.Lock()
+			result, ok := results[command]
+			if !ok {
+				result = sync.OnceValue(func() bool { return runMatchExec(command, deadline) })
+				results[command] = result
+			}
+			mu.Unlock()
+			return result()
+		},
+	}
+}
+
+// localUsername returns the name of the user executing the program.
+func localUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// runMatchExec reports whether 'command' exits successfully when run through
+// the user's shell as SSH does for 'Match exec'. It's given no longer than
+// until 'deadline' and isn't run at all once that has passed.
+func runMatchExec(command string, deadline time.Time) bool {
+	if timeout := time.Now().Add(matchExecTimeout); timeout.Before(deadline) {
+		deadline = timeout
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	if ctx.Err() != nil {
+		return false
+	}
+	return shellCommand(ctx, command).Run() == nil
+}
+
+// shellCommand returns a command that runs 'command' through the user's
+// shell, falling back to '/bin/sh' when the shell isn't known.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	return exec.CommandContext(ctx, shell, "-c", command)
+}
+
+// effectiveOptions returns the options SSH would use when connecting to 'host'
+// by applying every section of the configuration that matches it: the
+// options before the first section, 'Host' sections with patterns matching
+// 'host', and 'Match' sections whose criteria are all satisfied.
+//
+// Blocks from included files only apply when the section they were included
+// from applies. For each keyword the first obtained value wins. When a 'Match'
+// section uses the 'canonical' or 'final' criteria the configuration is
+// evaluated a second time as SSH does, with those criteria only matching on
+// the second pass.
+func (c sshConfig) effectiveOptions(host string, env *sshMatchEnv) []sshOption {
+	var options []sshOption
+	seen := make(map[string]bool)
+	applied := make(map[int]bool)
+
+	passes := []bool{false}
+	if c.hasFinalPass() {
+		passes = append(passes, true)
+	}
+
+	for _, final := range passes {
+		// Whether a block applies is decided once when it's reached, which
+		// is also what the blocks having it as their parent go by
+		active := make([]bool, len(c.Blocks))
+		for n, b := range c.Blocks {
+			if applied[n] {
+				active[n] = true
+				continue
+			}
+			active[n] = (b.Parent < 0 || active[b.Parent]) && b.matches(host, options, final, env)
+			if b.Invalid || !active[n] {
+				continue
+			}
+			applied[n] = true
+			options = appendOptions(options, seen, b.Options)
+		}
+	}
+
+	return options
+}
+
+// hasFinalPass reports whether any 'Match' section requires the configuration
+// to be evaluated a second time.
+func (c sshConfig) hasFinalPass() bool {
+	for _, b := range c.Blocks {
+		if b.Keyword != "match" {
+			continue
+		}
+		for _, p := range b.Patterns {
+			if p == "canonical" || p == "final" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches reports whether block 'b' applies to 'host' given the 'options'
+// obtained so far.
+func (b sshConfigBlock) matches(host string, options []sshOption, final bool, env *sshMatchEnv) bool {
+	switch b.Keyword {
+	case "host":
+		return matchHostPatterns(host, b.Patterns)
+	case "match":
+		return matchCriteria(host, b.Patterns, options, final, env)
+	}
+	return true
+}
+
+// matchHostPatterns reports whether 'host' matches the patterns of a 'Host'
+// section, meaning that at least one pattern matches and none of the negated
+// patterns do.
+func matchHostPatterns(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	matched := false
+	for _, p := range patterns {
+		negated := strings.HasPrefix(p, "!")
+		if !matchPattern(host, strings.ToLower(strings.TrimPrefix(p, "!"))) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// matchPatternList reports whether 's' matches the comma-separated 'list' of
+// patterns in the same manner as 'matchHostPatterns'.
+func matchPatternList(s, list string) bool {
+	return matchHostPatterns(s, strings.Split(list, ","))
+}
+
+// matchPattern reports whether 's' matches 'pattern' where '*' matches any
+// number of characters and '?' matches exactly one character.
+func matchPattern(s, pattern string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for pattern != "" && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchPattern(s[i:], pattern) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		s, pattern = s[1:], pattern[1:]
+	}
+	return s == ""
+}
+
+// matchCriteria reports whether every one of the 'criteria' of a 'Match'
+// section is satisfied for 'host'. Criteria that aren't supported never
+// match, so the section they are in is never applied.
+func matchCriteria(host string, criteria []string, options []sshOption, final bool, env *sshMatchEnv) bool {
+	for i := 0; i < len(criteria); i++ {
+		criterion := strings.ToLower(criteria[i])
+		negated := strings.HasPrefix(criterion, "!")
+		criterion = strings.TrimPrefix(criterion, "!")
+
+		var result bool
+		switch criterion {
+		case "all":
+			result = true
+		case "canonical", "final":
+			result = final
+		case "host", "originalhost", "user", "localuser", "exec", "tagged":
+			if i+1 == len(criteria) {
+				return false
+			}
+			i++
+			result = matchCriterion(criterion, criteria[i], host, options, env)
+		default:
+			return false
+		}
+
+		if result == negated {
+			return false
+		}
+	}
+	return true
+}
+
+// matchCriterion reports whether a single 'Match' criterion that takes an
+// argument is satisfied for 'host'.
+func matchCriterion(criterion, arg, host string, options []sshOption, env *sshMatchEnv) bool {
+	values := matchValues(host, options, env)
+	switch criterion {
+	case "host":
+		return matchPatternList(values['h'], arg)
+	case "originalhost":
+		return matchPatternList(host, arg)
+	case "user":
+		return matchPatternList(values['r'], arg)
+	case "localuser":
+		return matchPatternList(env.LocalUser, arg)
+	case "tagged":
+		return matchPatternList(optionValue(options, "tag"), arg)
+	case "exec":
+		return env.Exec(expandMatchTokens(arg, values))
+	}
+	return false
+}
+
+// matchValues returns what the tokens usable within 'Match exec' expand to
+// given the 'options' obtained so far for 'host'.
+func matchValues(host string, options []sshOption, env *sshMatchEnv) map[byte]string {
+	hostname := host
+	if v := optionValue(options, "hostname"); v != "" {
+		hostname = expandHostnameTokens(v, host)
+	}
+	remoteUser := env.LocalUser
+	if v := optionValue(options, "user"); v != "" {
+		remoteUser = v
+	}
+	port := "22"
+	if v := optionValue(options, "port"); v != "" {
+		port = v
+	}
+	localHostname, _ := os.Hostname()
+	home, _ := os.UserHomeDir()
+
+	return map[byte]string{
+		'%': "%",
+		'd': home,
+		'h': hostname,
+		'L': strings.SplitN(localHostname, ".", 2)[0],
+		'l': localHostname,
+		'n': host,
+		'p': port,
+		'r': remoteUser,
+		'u': env.LocalUser,
+	}
+}
+
+// expandMatchTokens returns 's' with every '%' token that has a value in
+// 'values' expanded. Unknown tokens are left as they are.
+func expandMatchTokens(s string, values map[byte]string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+1 < len(s) {
+			if v, ok := values[s[i+1]]; ok {
+				b.WriteString(v)
+				i++
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// optionValue returns the arguments of the first option named 'keyword' in
+// 'options' joined by spaces, or an empty string if there is no such option.
+func optionValue(options []sshOption, keyword string) string {
+	for _, o := range options {
+		if o.Keyword == keyword {
+			return strings.Join(o.Args, " ")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"charm.land/bubbles/v2/list"
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+)
+
+// Defaults for sweeping every host in the background.
+const (
+	defaultSweepWorkers = 8
+	defaultSweepRate    = 20
+	defaultSweepTTL     = 5 * time.Minute
+)
+
+var (
+	upStyle      = lipgloss.NewStyle().Foreground(nordAuroraGreen)
+	downStyle    = lipgloss.NewStyle().Foreground(nordAuroraRed)
+	unknownStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#777777"))
+)
+
+// Whether a host was reachable when it was last probed.
+type reachability int
+
+const (
+	reachUnknown reachability = iota
+	reachUp
+	reachDown
+)
+
+// A hostStatus is what probing a host found and when.
+type hostStatus struct {
+	State   reachability
+	Latency time.Duration
+	Checked time.Time
+}
+
+// marker returns the colored marker shown next to a host with the given
+// status, along with the latency for hosts that are up.
+func (s hostStatus) marker() string {
+	switch s.State {
+	case reachUp:
+		return upStyle.Render(fmt.Sprintf("● %v", roundRtt(s.Latency)))
+	case reachDown:
+		return downStyle.Render("● down")
+	}
+	return unknownStyle.Render("○")
+}
+
+// A sweepResultMsg carries the status of a host found by a sweep, where
+// 'address' is what the host was probed at.
+type sweepResultMsg struct {
+	address string
+	status  hostStatus
+	results <-chan sweepResultMsg
+}
+
+// A sweepDoneMsg indicates that the sweep with 'results' has probed every
+// host or was stopped.
+type sweepDoneMsg struct {
+	results <-chan sweepResultMsg
+}
+
+// A sweeper probes every host in the background through a bounded number
+// of workers while limiting how many probes are started per second.
+//
+// It's shared between copies of the model, so it's always used through a
+// pointer.
+type sweeper struct {
+	workers int
+	rate    int
+	timeout time.Duration
+	probe   string
+	sshOpts []string
+	cancel  context.CancelFunc
+	// results is where the sweep in progress sends its results
+	results <-chan sweepResultMsg
+}
+
+// running reports whether a sweep is in progress.
+func (s *sweeper) running() bool {
+	return s.cancel != nil
+}
+
+// start stops any sweep in progress and starts probing every one of 'items'
+// anew, returning a command that waits for the first result.
+func (s *sweeper) start(items []list.Item) tea.Cmd {
+	s.stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	addresses := make([]string, 0, len(items))
+	targets := make(map[string]Item)
+	for _, li := range items {
+		i := li.(Item)
+		a := i.probeAddress()
+		if _, ok := targets[a]; !ok {
+			addresses = append(addresses, a)
+			targets[a] = i
+		}
+	}
+
+	jobs := make(chan Item)
+	results := make(chan sweepResultMsg)
+	go func() {
+		defer close(jobs)
+		ticker := time.NewTicker(time.Second / time.Duration(max(s.rate, 1)))
+		defer ticker.Stop()
+		for _, a := range addresses {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- targets[a]:
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range max(s.workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				msg := sweepResultMsg{address: i.probeAddress(), status: probeStatus(ctx, i, s.probe, s.sshOpts, s.timeout), results: results}
+				if ctx.Err() != nil {
+					// Probes cut short by stopping say nothing about the host
+					continue
+				}
+				select {
+				case <-ctx.Done():
+				case results <- msg:
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	s.results = results
+	return waitForSweepResult(results)
+}
+
+// stop cancels the sweep in progress, if any.
+func (s *sweeper) stop() {
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel, s.results = nil, nil
+	}
+}
+
+// done marks the sweep with 'results' as finished, unless another sweep has
+// been started since.
+func (s *sweeper) done(results <-chan sweepResultMsg) {
+	if s.results == results {
+		s.stop()
+	}
+}
+
+// probeStatus probes 'i' within 'timeout' in the way chosen with '-probe'
+// and returns what was found. Any 'ping' still running when 'ctx' is done is
+// killed.
+func probeStatus(ctx context.Context, i Item, probe string, sshOpts []string, timeout time.Duration) hostStatus {
+	status := hostStatus{State: reachDown, Checked: time.Now()}
+	if probe == tcpProbe {
+		if result := probeItem(ctx, i, sshOpts, timeout); result.Err == nil {
+			status.State, status.Latency = reachUp, result.Latency
+		}
+		return status
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	out, _ := exec.CommandContext(ctx, "ping", append([]string{i.connectHost()}, newPingOpts(1)...)...).Output()
+	if result, err := parsePingOutput(strings.Split(string(out), "\n")); err == nil && result.Received > 0 {
+		status.State, status.Latency = reachUp, result.Avg
+	}
+	return status
+}
+
+// waitForSweepResult returns a command that waits for the next result of a
+// sweep on 'results'.
+func waitForSweepResult(results <-chan sweepResultMsg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-results
+		if !ok {
+			return sweepDoneMsg{results: results}
+		}
+		return msg
+	}
+}
+
+// markUnknown returns 'items' where every host without a status yet has an
+// unknown one, which is shown until a sweep reaches it.
+func markUnknown(items []list.Item) []list.Item {
+	for n, li := range items {
+		i := li.(Item)
+		if i.Status == nil {
+			i.Status = &hostStatus{}
+			items[n] = i
+		}
+	}
+	return items
+}
+
+// applyStatus returns 'items' with the status of every host probed at
+// 'address' set to 'status'.
+func applyStatus(items []list.Item, address string, status hostStatus) []list.Item {
+	for n, li := range items {
+		i := li.(Item)
+		if i.probeAddress() == address {
+			i.Status = &status
+			items[n] = i
+		}
+	}
+	return items
+}
+
+// A statusCache holds the status of every host found by earlier sweeps by
+// the address the host was probed at, which is kept in a file so the next
+// launch can show them right away.
+type statusCache map[string]hostStatus
+
+// statusCachePath returns the path to the file the status cache is kept in.
+func statusCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "wishlistlite", "status.json"), nil
+}
+
+// loadStatusCache returns the status cache kept at 'filePath', which is
+// empty when there is no such file yet.
+func loadStatusCache(filePath string) (statusCache, error) {
+	cache := make(statusCache)
+	content, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &cache); err != nil {
+		return nil, fmt.Errorf("could not parse file '%s': %w", filePath, err)
+	}
+	return cache, nil
+}
+
+// save writes the cache to 'filePath', creating its directory if needed.
+func (c statusCache) save(filePath string) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o700); err != nil {
+		return err
+	}
+	content, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, content, 0o600)
+}
+
+// apply returns 'items' with the status of every host that was probed
+// within 'ttl' set from the cache.
+func (c statusCache) apply(items []list.Item, ttl time.Duration) []list.Item {
+	for address, status := range c {
+		if time.Since(status.Checked) < ttl {
+			items = applyStatus(items, address, status)
+		}
+	}
+	return items
+}
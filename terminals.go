@@ -0,0 +1,70 @@
+package main
+
+import "os"
+
+func init() {
+	registerLauncher("kitty", kittyLauncher{kind: "tab"})
+	registerLauncher("kitty-window", kittyLauncher{kind: "os-window"})
+	registerLauncher("wezterm", weztermLauncher{})
+	registerLauncher("wezterm-window", weztermLauncher{window: true})
+}
+
+// A kittyLauncher opens sessions in a new tab or window of kitty through
+// its remote control, which must be allowed with 'allow_remote_control'.
+type kittyLauncher struct {
+	kind string
+}
+
+// Args returns the 'kitty @ launch' command for opening a session with 'i'
+// in a tab or window titled after it.
+func (k kittyLauncher) Args(i Item, sshArgs []string) []string {
+	args := []string{"kitty", "@", "launch", "--type=" + k.kind, "--title", i.Host}
+	if k.kind == "tab" {
+		args = append(args, "--tab-title", i.Host)
+	}
+	return append(args, sshCommand(sshArgs)...)
+}
+
+// Available reports whether the program is running inside kitty or kitty
+// was told where to be remote controlled at.
+func (k kittyLauncher) Available() bool {
+	return os.Getenv("KITTY_WINDOW_ID") != "" || os.Getenv("KITTY_LISTEN_ON") != ""
+}
+
+// String returns whether sessions are opened in a tab or a window.
+func (k kittyLauncher) String() string {
+	if k.kind == "tab" {
+		return "kitty tab"
+	}
+	return "kitty window"
+}
+
+// A weztermLauncher opens sessions in a new tab or window of WezTerm
+// through 'wezterm cli spawn'.
+type weztermLauncher struct {
+	window bool
+}
+
+// Args returns the 'wezterm cli spawn' command for opening a session with
+// 'i'. WezTerm titles tabs after what runs in them, so the host's name
+// isn't given.
+func (w weztermLauncher) Args(i Item, sshArgs []string) []string {
+	args := []string{"wezterm", "cli", "spawn"}
+	if w.window {
+		args = append(args, "--new-window")
+	}
+	return append(append(args, "--"), sshCommand(sshArgs)...)
+}
+
+// Available reports whether the program is running inside WezTerm.
+func (w weztermLauncher) Available() bool {
+	return os.Getenv("WEZTERM_PANE") != ""
+}
+
+// String returns whether sessions are opened in a tab or a window.
+func (w weztermLauncher) String() string {
+	if w.window {
+		return "WezTerm window"
+	}
+	return "WezTerm tab"
+}
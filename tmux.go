@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+)
+
+// Where in tmux a session can be opened.
+const (
+	tmuxWindow = "window"
+	tmuxSplit  = "split"
+)
+
+func init() {
+	registerLauncher("tmux", tmuxLauncher{where: tmuxWindow})
+	registerLauncher("tmux-split", tmuxLauncher{where: tmuxSplit})
+}
+
+// insideTmux reports whether the program is running inside tmux, which is
+// the only place sessions can be opened in tmux from.
+func insideTmux() bool {
+	return os.Getenv("TMUX") != ""
+}
+
+// tmuxArgs returns the arguments given to tmux for opening a session with
+// SSH using 'sshArgs' in a new window called 'name', or in a new pane
+// split from the current one with 'name' as its title.
+func tmuxArgs(where, name string, sshArgs []string) []string {
+	command := sshCommand(sshArgs)
+	if where == tmuxSplit {
+		args := append([]string{"split-window", "-h"}, command...)
+		// The new pane is the current one after splitting
+		return append(args, ";", "select-pane", "-T", name)
+	}
+	return append([]string{"new-window", "-n", name}, command...)
+}
+
+// A tmuxLauncher opens sessions in a new tmux window or split.
+type tmuxLauncher struct {
+	where string
+}
+
+// Args returns the tmux command for opening a session with 'i'.
+func (t tmuxLauncher) Args(i Item, sshArgs []string) []string {
+	return append([]string{"tmux"}, tmuxArgs(t.where, i.Host, sshArgs)...)
+}
+
+// Available reports whether the program is running inside tmux.
+func (t tmuxLauncher) Available() bool { return insideTmux() }
+
+// String returns whether sessions are opened in a window or a split.
+func (t tmuxLauncher) String() string { return "tmux " + t.where }
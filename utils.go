@@ -1,12 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"runtime/debug"
 	"strings"
@@ -41,6 +42,9 @@ func userHomeDir() string {
 // tilde character expanded to the current user's home
 // directory, if a tilde was actually present.
 func expandTilde(filePath string) string {
+	if filePath == "" {
+		return filePath
+	}
 	if filePath[0] == '~' {
 		return fmt.Sprintf("%s%s", userHomeDir(), filePath[1:])
 	}
@@ -57,58 +61,28 @@ func iniHosts(filePath string, switchFilter bool) ([]list.Item, error) {
 		return nil, fmt.Errorf("could not read file '%s': %w", filePath, err)
 	}
 
-	items := findIniHosts(content, switchFilter)
+	items, err := findIniHosts(content, switchFilter)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse file '%s': %w", filePath, err)
+	}
+	setOriginFile(items, filePath)
 	return items, nil
 }
 
-// findIniHosts returns a slice of 'list.Item' from the given 'content' slice of bytes.
-func findIniHosts(content []byte, switchFilter bool) []list.Item {
-	// Grab all sections between brackets if they just contain letters and hyphens,
-	// and group all the lines after them.
-	pat := regexp.MustCompile(`(?m)^\[[a-zA-Z-]*\][\r\n]((?:[a-zA-Z0-9-_\.]+(?:[\r\n]|\s)?(?:ansible_host=[^\s]+\s)?.*[\r\n])+)`)
-	mainMatches := pat.FindAllStringSubmatch(string(content), -1)
-
-	// Map for checking whether host already exists
-	hostMapBool := make(map[string]bool)
-
-	var items []list.Item
-	// Make sure every line starts with alphanumeric characters and a limited
-	// set of symbols, potentially followed by an 'ansible_host' variable.
-	pat = regexp.MustCompile(`(?m)^([a-zA-Z0-9-_\.]+)(?:\s+ansible_host=([^\s]+))?`)
-	for _, m := range mainMatches {
-		for _, n := range pat.FindAllStringSubmatch(m[1], -1) {
-			// Use the first set of characters as a basis for checking duplicates
-			if _, ok := hostMapBool[n[1]]; ok {
-				continue
-			}
-			hostMapBool[n[1]] = true
-
-			i := Item{Host: n[1], Hostname: n[1], SwitchFilter: switchFilter}
-			if n[2] != "" {
-				i = Item{Host: n[2], Hostname: n[1], SwitchFilter: switchFilter}
-			}
-			items = append(items, i)
-		}
+// findIniHosts returns a slice of 'list.Item' from the given 'content' slice
+// of bytes in the INI format of Ansible inventories, where each 'Item' carries
+// the groups the host belongs to and the variables applying to it.
+func findIniHosts(content []byte, switchFilter bool) ([]list.Item, error) {
+	inv, err := parseIniInventory(content)
+	if err != nil {
+		return nil, err
 	}
-
-	return items
+	return inv.items(switchFilter), nil
 }
 
-// allItems represents a multi-dimensional slice of 'list.Item'.
-// Each additional slice within the outer slice represents a
-// slice of 'list.Item' from an 'Include' in 'sshConfigHosts'.
-var allItems [][]list.Item
-
-// sshConfigHosts returns a slice of 'list.Item' containing hosts from an SSH
-// configuration as type 'Item' and 'error'.
-//
-// It reads a file expected to be a valid SSH configuration file and uses
-// regular expressions to grab 'Include', 'Host', and 'Hostname' values where
-// possible. Possible meaning that it looks for sections of 'Host' that have a
-// 'HostName' field beneath it. Anything other than 'HostName' beneath it is
-// disregarded as they (most likely) include fields like 'User', 'ProxyJump', etc. that
-// have no bearing on listing valid hosts.
-func sshConfigHosts(filePath string) ([]list.Item, error) {
+// yamlHosts returns a slice of 'list.Item' containing hosts from a YAML
+// file (e.g. Ansible inventory file) as type 'Item' and 'error'.
+func yamlHosts(filePath string, switchFilter bool) ([]list.Item, error) {
 	filePath = expandTilde(filePath)
 
 	content, err := os.ReadFile(filePath)
@@ -116,127 +90,83 @@ func sshConfigHosts(filePath string) ([]list.Item, error) {
 		return nil, fmt.Errorf("could not read file '%s': %w", filePath, err)
 	}
 
-	filePaths, includeCount := findIncludedFiles(content)
-
-	for _, i := range filePaths {
-		j, err := sshConfigHosts(i)
-		if err == nil {
-			allItems = append(allItems, j)
-		} else {
-			continue
-		}
-	}
-
-	items := findHosts(content)
-
-	// This should only trigger when at the top level, thus
-	// causing a return of all found hosts from the main file
-	// and from any included files if there were any
-	if len(allItems) == includeCount && includeCount != 0 {
-		allItems = append(allItems, items)
-		flattened := flatten(allItems)
-
-		var result []list.Item
-
-		hostMapBool := make(map[string]bool)
-		for _, j := range flattened {
-			// Use 'Host' value as a basis for checking duplicates
-			key := j.(Item).Host
-			if _, ok := hostMapBool[key]; ok {
-				continue
-			}
-			hostMapBool[key] = true
-			result = append(result, j.(Item))
-		}
-
-		allItems = nil
-		flattened = nil
-		return result, nil
+	inv, err := parseYamlInventory(content)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse file '%s': %w", filePath, err)
 	}
-
-	// This should trigger when looking inside of an included
-	// file or when there were no included files
+	items := inv.items(switchFilter)
+	setOriginFile(items, filePath)
 	return items, nil
 }
 
-// findIncludedFiles returns a slice of strings, each being
-// a file name that was found next to an 'Include' option in
-// the given 'content' slice of bytes, and the total count
-// of 'Include' options where in the case of a wildcard
-// include the count is increased by however many filenames
-// are returned by '[filepath.Glob]'.
-func findIncludedFiles(content []byte) ([]string, int) {
-	var (
-		pat          *regexp.Regexp
-		filePaths    []string
-		includeCount int
-	)
-
-	pat = regexp.MustCompile(`(?m)^Include\s([a-zA-Z0-9_\-\.\~\*\/]*)`)
-	includeMatches := pat.FindAllStringSubmatch(string(content), -1)
-
-	for _, i := range includeMatches {
-		// If an 'Include' value's (i[1]) last character (i[1][len(i[1])-1]) is a wildcard
-		if i[1][len(i[1])-1] == '*' {
-			i[1] = expandTilde(i[1])
-			matches, _ := filepath.Glob(i[1])
-			// Add all the globbed matches
-			filePaths = append(filePaths, matches...)
-			includeCount += len(matches)
-		} else {
-			// Add whatever was the 'Include' value
-			filePaths = append(filePaths, i[1])
-			includeCount += 1
-		}
+// commandHosts returns a slice of 'list.Item' containing hosts from the JSON
+// written to standard output by 'command' (e.g. 'ansible-inventory --list')
+// as type 'Item' and 'error'.
+//
+// The command is run through the user's shell and must finish within
+// 'inventoryCommandTimeout' unless 'ctx' is done before that.
+func commandHosts(ctx context.Context, command string, switchFilter bool) ([]list.Item, error) {
+	ctx, cancel := context.WithTimeout(ctx, inventoryCommandTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	c := shellCommand(ctx, command)
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not run '%s': %w: %s", command, err, strings.TrimSpace(stderr.String()))
 	}
 
-	return filePaths, includeCount
+	inv, err := parseJsonInventory(out)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse output of '%s': %w", command, err)
+	}
+	return inv.items(switchFilter), nil
 }
 
-// findHosts returns a slice of 'list.Item' from each value found next to a
-// 'Host' option in the given 'content' slice of bytes.
-func findHosts(content []byte) []list.Item {
-	// Grab all 'Host' ('Host' not included), 'HostName' ('HostName' included),
-	// and whatever was right after 'HostName' if anything. That 'whatever' will
-	// be used as something that differentiates between two identical 'HostName'
-	// values.
-	pat := regexp.MustCompile(`(?m)^Host\s([^\*][a-zA-Z0-9_\.-]*)(\s+HostName[^\r\n][a-zA-Z0-9_\.-]+)?([\r\n][^\r\n].*)?`)
-	mainMatches := pat.FindAllStringSubmatch(string(content), -1)
-
-	// Map for checking whether host already exists
-	hostMapBool := make(map[string]bool)
-
-	// Make sure 'HostName' was defined correctly (i.e. followed by a space)
-	pat = regexp.MustCompile(`HostName\s(.*)`)
-	var items []list.Item
-	for _, m := range mainMatches {
-		// Use 'Host' value as a basis for checking duplicates
-		if _, ok := hostMapBool[m[1]]; ok {
-			continue
-		}
-
-		hostMapBool[m[1]] = true
-		// If 'HostName' was present
-		if m[2] != "" {
-			for _, n := range pat.FindAllStringSubmatch(m[2], -1) {
-				// 'm[3]' represents anything additional after 'HostName' limited to one line
-				items = append(items, Item{Host: m[1], Hostname: n[1], Extra: strings.TrimSpace(m[3])})
-			}
-		} else {
-			items = append(items, Item{Host: m[1], Hostname: m[1]})
+// inventoryFormat returns the format of the inventory file at 'filePath',
+// which is the given 'format' unless it's empty, in which case the file's
+// extension decides between YAML and INI.
+func inventoryFormat(filePath, format string) (string, error) {
+	switch format {
+	case "ini", "yaml":
+		return format, nil
+	case "":
+		switch strings.ToLower(filepath.Ext(filePath)) {
+		case ".yml", ".yaml":
+			return "yaml", nil
 		}
+		return "ini", nil
 	}
+	return "", fmt.Errorf("unknown inventory format '%s'", format)
+}
 
-	return items
+// sshConfigHosts returns a slice of 'list.Item' containing hosts from an SSH
+// configuration as type 'Item' and 'error'.
+//
+// It reads a file expected to be a valid SSH configuration file and parses
+// it according to ssh_config(5), following any 'Include' options with
+// relative paths being resolved against 'includeDir'. Every host named in a
+// 'Host' section becomes an item that carries all of the options applying
+// to it.
+//
+// When some of the 'Include' options could not be followed, the hosts that
+// were found are returned along with an error of type '*includeError'.
+func sshConfigHosts(filePath, includeDir string) ([]list.Item, error) {
+	s := &sshConfigHostSource{path: expandTilde(filePath), includeDir: includeDir}
+	return s.Load(context.Background())
 }
 
-// flatten returns a flattened slice from a multi-dimensional slice.
-func flatten[T any](lists [][]T) []T {
-	var res []T
-	for _, list := range lists {
-		res = append(res, list...)
-	}
-	return res
+// findHosts returns a slice of 'list.Item' from each host named next to a
+// 'Host' option in the given 'content' slice of bytes.
+//
+// Each host gets the options SSH itself would use, which come from every
+// 'Host' section with a pattern matching it as well as every 'Match' section
+// with criteria satisfied by it, with the first obtained value for each
+// option winning. Sections containing lines that can't be parsed are
+// disregarded entirely.
+func findHosts(content []byte) []list.Item {
+	return parseSshConfig(content).items(newSshMatchEnv())
 }
 
 // itemsToJson writes to filePath a slice of 'list.Item' as JSON and returns